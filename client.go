@@ -0,0 +1,218 @@
+// Copyright 2025 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Client module of webtransport package.
+
+package webtransport
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/quic-go/qpack"
+	"github.com/quic-go/quic-go"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// ErrNotSupported is returned by Dialer.Dial if the server does not support
+// any WebTransport draft supported by this package.
+var ErrNotSupported = fmt.Errorf("server does not support webtransport")
+
+// sessionCloseTimeout is how long the client waits for the server to close the
+// request stream of a closed session before it closes the connection.
+const sessionCloseTimeout = time.Second
+
+// A Dialer defines parameters for dialing WebTransport sessions on a
+// WebTransport-over-HTTP/3 server.
+type Dialer struct {
+	// TLSClientConfig specifies the TLS configuration to use. Set its RootCAs
+	// to trust custom certificate authorities. If nil, the default
+	// configuration is used.
+	TLSClientConfig *tls.Config
+	// Additional configuration parameters to pass onto QUIC dialer
+	QuicConfig *QuicConfig
+	// SessionMaxData, SessionMaxStreamsBidi and SessionMaxStreamsUni set the
+	// flow control limits of the session for the server, as on Server. If
+	// zero, the value is not limited.
+	SessionMaxData        uint64
+	SessionMaxStreamsBidi uint64
+	SessionMaxStreamsUni  uint64
+}
+
+// Dial dials a WebTransport session on the server at the given https URL. It
+// performs the QUIC handshake, exchanges the HTTP/3 SETTINGS with the server
+// and sends an extended CONNECT request with the supplied headers. The
+// supplied Context is used for dialing only.
+//
+// Dial returns the server response and the established session. If the server
+// rejects the session, the response is returned together with an error. Each
+// session uses its own QUIC connection, which is closed when the session ends.
+func (d *Dialer) Dial(ctx context.Context, urlStr string,
+	reqHdr http.Header) (*http.Response, *Session, error) {
+
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Scheme != "https" {
+		return nil, nil, fmt.Errorf("unsupported webtransport url scheme: %q", u.Scheme)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	// Make TLS and QUIC configuration
+	tlsConfig := &tls.Config{}
+	if d.TLSClientConfig != nil {
+		tlsConfig = d.TLSClientConfig.Clone()
+	}
+	tlsConfig.NextProtos = []string{"h3"}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = u.Hostname()
+	}
+	quicConfig := &quic.Config{}
+	if d.QuicConfig != nil {
+		quicConfig = (*quic.Config)(d.QuicConfig).Clone()
+	}
+	quicConfig.EnableDatagrams = true
+
+	// Dial QUIC connection
+	qconn, err := quic.DialAddr(ctx, addr, tlsConfig, quicConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	fail := func(err error) (*http.Response, *Session, error) {
+		qconn.CloseWithError(h3.H3_NO_ERROR, "")
+		return nil, nil, err
+	}
+
+	// Open the client control stream and write the client settings,
+	// advertising every supported draft
+	c := newConn(nil, qconn)
+	settings := h3.SettingsMap{
+		h3.SETTINGS_H3_DATAGRAM:      1,
+		h3.H3_DATAGRAM_05:            1,
+		h3.ENABLE_WEBTRANSPORT:       1,
+		h3.WEBTRANSPORT_MAX_SESSIONS: 1,
+	}
+	c.limits = flowLimits{
+		maxData:        d.SessionMaxData,
+		maxStreamsBidi: d.SessionMaxStreamsBidi,
+		maxStreamsUni:  d.SessionMaxStreamsUni,
+	}
+	c.limits.addSettings(settings)
+	err = c.openControlStream(settings)
+	if err != nil {
+		return fail(err)
+	}
+	go c.acceptUniStreams()
+	go c.receiveDatagrams()
+	go c.acceptStreams(qconn.Context())
+
+	// Wait for server settings and pick the newest draft supported by both
+	// sides
+	if !c.waitSettings(ctx) {
+		if ctx.Err() != nil {
+			return fail(ctx.Err())
+		}
+		return fail(context.Cause(qconn.Context()))
+	}
+	draft, ok := negotiateDraft(c.peerSettings)
+	if !ok {
+		qconn.CloseWithError(h3.H3_SETTINGS_ERROR, ErrNotSupported.Error())
+		return nil, nil, ErrNotSupported
+	}
+
+	// Send extended CONNECT request
+	requestStream, err := qconn.OpenStreamSync(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	c.addRequest(requestStream.StreamID())
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    u,
+		Header: http.Header{},
+		Host:   u.Host,
+	}
+	if reqHdr != nil {
+		req.Header = reqHdr.Clone()
+	}
+	if draft == Draft02 {
+		req.Header.Set("sec-webtransport-http3-draft02", "1")
+	}
+	if err = h3.WriteRequestHeaders(requestStream, req, "webtransport"); err != nil {
+		return fail(err)
+	}
+
+	// Read response, stop reading if the context is canceled
+	stop := context.AfterFunc(ctx, func() {
+		requestStream.CancelRead(h3.H3_REQUEST_CANCELLED)
+	})
+	resp, err := readResponse(requestStream)
+	if !stop() {
+		return fail(ctx.Err())
+	}
+	if err != nil {
+		return fail(err)
+	}
+	resp.Request = req
+	resp.Body = http.NoBody
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		fail(nil)
+		return resp, nil, fmt.Errorf("webtransport session rejected with status %d",
+			resp.StatusCode)
+	}
+
+	// Create the session
+	session := newSession(c, requestStream, draft, qconn.Context())
+	c.addSession(session, 1)
+	go session.watchRequestStream()
+
+	// The connection of the session is closed when the session ends. The
+	// server is given some time to receive the close of the session first.
+	context.AfterFunc(session.Context(), func() {
+		select {
+		case <-session.watchDone:
+		case <-time.After(sessionCloseTimeout):
+		}
+		qconn.CloseWithError(h3.H3_NO_ERROR, "")
+	})
+
+	return resp, session, nil
+}
+
+// readResponse reads the final response of a request from the request stream,
+// skipping interim responses.
+func readResponse(requestStream quic.Stream) (*http.Response, error) {
+	decoder := qpack.NewDecoder(nil)
+	for {
+		headersFrame := h3.Frame{}
+		err := headersFrame.ReadMax(requestStream, maxHeadersFrameLen)
+		if err != nil {
+			if err == h3.ErrFrameTooLarge {
+				requestStream.CancelRead(h3.H3_EXCESSIVE_LOAD)
+				requestStream.CancelWrite(h3.H3_EXCESSIVE_LOAD)
+			}
+			return nil, err
+		}
+		if headersFrame.Type != h3.FRAME_HEADERS {
+			return nil, h3.ErrFrameUnexpected
+		}
+		hfs, err := decoder.DecodeFull(headersFrame.Data)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := h3.ResponseFromHeaders(hfs)
+		if err != nil || resp.StatusCode >= 200 {
+			return resp, err
+		}
+	}
+}
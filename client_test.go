@@ -0,0 +1,136 @@
+package webtransport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/quic-go/qpack"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// readerStream is a quic.Stream reading from a reader. Only Read, CancelRead
+// and CancelWrite may be called.
+type readerStream struct {
+	quic.Stream
+	r                           io.Reader
+	readCanceled, writeCanceled bool
+	readCode, writeCode         quic.StreamErrorCode
+}
+
+func (s *readerStream) Read(p []byte) (int, error) { return s.r.Read(p) }
+
+func (s *readerStream) CancelRead(code quic.StreamErrorCode) {
+	s.readCanceled, s.readCode = true, code
+}
+
+func (s *readerStream) CancelWrite(code quic.StreamErrorCode) {
+	s.writeCanceled, s.writeCode = true, code
+}
+
+// headersFrame returns a HEADERS frame with the response status.
+func headersFrame(t *testing.T, status string) []byte {
+	t.Helper()
+	var headers bytes.Buffer
+	enc := qpack.NewEncoder(&headers)
+	if err := enc.WriteField(qpack.HeaderField{Name: ":status", Value: status}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	f := h3.Frame{
+		Type:   h3.FRAME_HEADERS,
+		Length: uint64(headers.Len()),
+		Data:   headers.Bytes(),
+	}
+	f.Write(&buf)
+	return buf.Bytes()
+}
+
+func TestReadResponseSkipsInterimResponses(t *testing.T) {
+	data := append(headersFrame(t, "103"), headersFrame(t, "200")...)
+	resp, err := readResponse(&readerStream{r: bytes.NewReader(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("got status %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestReadResponseFrameTooLarge(t *testing.T) {
+	// A HEADERS frame announcing a huge payload is rejected without
+	// allocating it
+	b := quicvarint.Append(nil, h3.FRAME_HEADERS)
+	b = quicvarint.Append(b, 1<<61)
+	str := &readerStream{r: bytes.NewReader(b)}
+
+	if _, err := readResponse(str); err != h3.ErrFrameTooLarge {
+		t.Fatalf("got %v, want h3.ErrFrameTooLarge", err)
+	}
+	if !str.readCanceled || str.readCode != h3.H3_EXCESSIVE_LOAD ||
+		!str.writeCanceled || str.writeCode != h3.H3_EXCESSIVE_LOAD {
+		t.Fatalf("stream not reset with H3_EXCESSIVE_LOAD: %+v", str)
+	}
+}
+
+func TestDial(t *testing.T) {
+	s := &Server{}
+	headers := make(chan http.Header, 1)
+	s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		session := r.Body.(*Session)
+		session.AcceptSession()
+		<-session.Context().Done()
+	})
+	url := startServer(t, s)
+
+	resp, session, err := testDialer().Dial(testContext(t), url+"/wt",
+		http.Header{"X-Token": {"secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.CloseSession()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want 200", resp.StatusCode)
+	}
+	if v := (<-headers).Get("X-Token"); v != "secret" {
+		t.Fatalf("the server got X-Token %q", v)
+	}
+}
+
+func TestDialRejected(t *testing.T) {
+	s := &Server{}
+	s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body.(*Session).RejectSession(http.StatusForbidden)
+	})
+	url := startServer(t, s)
+
+	resp, session, err := testDialer().Dial(testContext(t), url+"/wt", nil)
+	if err == nil || session != nil {
+		t.Fatal("the session was established")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("got response %v, want 403", resp)
+	}
+}
+
+func TestDialURL(t *testing.T) {
+	for _, url := range []string{"http://localhost/wt", "://"} {
+		if _, _, err := testDialer().Dial(context.Background(), url, nil); err == nil {
+			t.Errorf("dialed %q", url)
+		}
+	}
+}
+
+func TestDialContextCanceled(t *testing.T) {
+	url := startServer(t, &Server{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := testDialer().Dial(ctx, url+"/wt", nil); err == nil {
+		t.Fatal("dialed with a canceled context")
+	}
+}
@@ -0,0 +1,394 @@
+// Copyright 2025 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Connection module of webtransport package.
+
+package webtransport
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// maxBufferedStreams is the maximum number of streams buffered per connection
+// for sessions which are not established yet.
+const maxBufferedStreams = 16
+
+// maxHeadersFrameLen is the maximum length of a HEADERS frame payload read
+// from the peer, as the default limit of net/http on the size of the request
+// headers.
+const maxHeadersFrameLen = http.DefaultMaxHeaderBytes
+
+// datagramQueueLen is the number of received datagrams buffered per session.
+// Datagrams received when the queue is full are dropped.
+const datagramQueueLen = 32
+
+// conn is an HTTP/3 connection carrying WebTransport sessions. It owns the
+// control streams and routes incoming streams and datagrams to the sessions
+// established on the connection by their session ID. It is used on both the
+// server and the client side; server is nil on the client side.
+type conn struct {
+	quic.Connection
+	server    *Server
+	overLimit bool // connection exceeds Server.MaxConnections
+	limits    flowLimits
+	// maxPendingStreams is the size of the accept queues of the sessions
+	maxPendingStreams int
+	controlStream     quic.SendStream
+	peerControlStream quic.ReceiveStream
+
+	// settingsReceived is closed when the peer SETTINGS frame has been read
+	// into peerSettings
+	settingsReceived chan struct{}
+	peerSettings     h3.SettingsMap
+
+	// QPACK streams of the peer; the dynamic table is not used, so their
+	// contents are discarded
+	peerEncoderStream quic.ReceiveStream
+	peerDecoderStream quic.ReceiveStream
+
+	mu       sync.Mutex
+	sessions map[quic.StreamID]*Session
+	pending  []pendingStream
+	// requests are the request streams which may still become sessions;
+	// streams of other sessions than these and the established ones are
+	// rejected
+	requests map[quic.StreamID]struct{}
+
+	// nextStreamID is the lowest client-initiated bidirectional stream ID
+	// which was not accepted yet
+	nextStreamID quic.StreamID
+	// goAwayID is the stream ID sent in the GOAWAY frame; requests on
+	// streams with this or a higher ID are rejected
+	goAwayID  quic.StreamID
+	goingAway bool
+	// peerGoAwayID is the ID from the last GOAWAY frame received from the
+	// peer, peerGoingAway is set when one was received
+	peerGoAwayID  uint64
+	peerGoingAway bool
+}
+
+// pendingStream is a WebTransport stream received before its session was
+// established. Either bidi or uni is set.
+type pendingStream struct {
+	sessionID quic.StreamID
+	bidi      quic.Stream
+	uni       quic.ReceiveStream
+}
+
+// streamID returns the stream ID of the stream.
+func (p pendingStream) streamID() quic.StreamID {
+	if p.bidi != nil {
+		return p.bidi.StreamID()
+	}
+	return p.uni.StreamID()
+}
+
+// reset resets the stream with the given error code.
+func (p pendingStream) reset(code quic.StreamErrorCode) {
+	if p.bidi != nil {
+		p.bidi.CancelRead(code)
+		p.bidi.CancelWrite(code)
+	} else {
+		p.uni.CancelRead(code)
+	}
+}
+
+// newConn creates a new conn for the quic.Connection. The server is nil on the
+// client side.
+func newConn(s *Server, qconn quic.Connection) *conn {
+	return &conn{
+		Connection:        qconn,
+		server:            s,
+		maxPendingStreams: DefaultMaxPendingStreams,
+		settingsReceived:  make(chan struct{}),
+		sessions:          make(map[quic.StreamID]*Session),
+		requests:          make(map[quic.StreamID]struct{}),
+	}
+}
+
+// openControlStream opens the control stream and writes the SETTINGS frame to
+// it.
+func (c *conn) openControlStream(settings h3.SettingsMap) error {
+	controlStream, err := c.OpenUniStream()
+	if err != nil {
+		return err
+	}
+	c.controlStream = controlStream
+
+	// Write control stream header
+	streamHeader := h3.StreamHeader{Type: h3.STREAM_CONTROL}
+	if _, err := streamHeader.Write(controlStream); err != nil {
+		return err
+	}
+
+	// Write settings
+	settingsFrame := settings.ToFrame()
+	_, err = settingsFrame.Write(controlStream)
+	return err
+}
+
+// addSession registers a WebTransport session on the connection and hands it
+// the streams which arrived before the session was established. It returns
+// false if the connection already carries the maximum number of sessions.
+func (c *conn) addSession(s *Session, maxSessions uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if uint64(len(c.sessions)) >= maxSessions {
+		return false
+	}
+	id := s.StreamID()
+	c.sessions[id] = s
+	delete(c.requests, id)
+
+	// Sessions established after GOAWAY drain right away
+	if c.goingAway {
+		s.drainSession()
+	}
+
+	// Move pending streams of this session to its accept queues
+	pending := c.pending[:0]
+	for _, p := range c.pending {
+		if p.sessionID != id {
+			pending = append(pending, p)
+			continue
+		}
+		s.pushStream(p)
+	}
+	c.pending = pending
+
+	return true
+}
+
+// removeSession unregisters a WebTransport session from the connection.
+func (c *conn) removeSession(id quic.StreamID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sessions, id)
+}
+
+// session returns the WebTransport session with the given session ID or nil.
+func (c *conn) session(id quic.StreamID) *Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessions[id]
+}
+
+// streamAccepted records the ID of an accepted bidirectional stream. A
+// client-initiated stream may be a request which becomes a session.
+func (c *conn) streamAccepted(id quic.StreamID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id >= c.nextStreamID {
+		c.nextStreamID = id + 4
+	}
+	if isSessionID(id) {
+		c.requests[id] = struct{}{}
+	}
+}
+
+// addRequest records the ID of a request stream opened by the client which may
+// become a session.
+func (c *conn) addRequest(id quic.StreamID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests[id] = struct{}{}
+}
+
+// requestDone records that the request stream with the given ID did not become
+// a session, or is not a request stream at all. The buffered streams of this
+// session ID are rejected.
+func (c *conn) requestDone(id quic.StreamID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.requests[id]; !ok {
+		return
+	}
+	delete(c.requests, id)
+
+	pending := c.pending[:0]
+	for _, p := range c.pending {
+		if p.sessionID == id {
+			p.reset(h3.H3_ID_ERROR)
+			continue
+		}
+		pending = append(pending, p)
+	}
+	c.pending = pending
+}
+
+// isSessionID reports whether the stream ID may be the ID of a session, that
+// is the ID of a client-initiated bidirectional stream.
+func isSessionID(id quic.StreamID) bool {
+	return id%4 == 0
+}
+
+// requestRejected reports whether a request on the stream with the given ID
+// must be rejected because it was opened after GOAWAY.
+func (c *conn) requestRejected(id quic.StreamID) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.goingAway && id >= c.goAwayID
+}
+
+// goAway sends a GOAWAY frame on the control stream so that the client
+// opens no new requests on the connection, and tells all sessions of the
+// connection to drain.
+func (c *conn) goAway() {
+	c.mu.Lock()
+	if c.goingAway {
+		c.mu.Unlock()
+		return
+	}
+	c.goingAway = true
+	c.goAwayID = c.nextStreamID
+	sessions := slices.Collect(maps.Values(c.sessions))
+	c.mu.Unlock()
+
+	// The GOAWAY frame carries the first stream ID which will not be processed
+	goAwayFrame := h3.Frame{
+		Type: h3.FRAME_GOAWAY,
+		Data: quicvarint.Append(nil, uint64(c.goAwayID)),
+	}
+	goAwayFrame.Length = uint64(len(goAwayFrame.Data))
+	goAwayFrame.Write(c.controlStream)
+
+	for _, s := range sessions {
+		s.drainSession()
+	}
+}
+
+// acceptStreams accepts bidirectional streams opened by the peer until the
+// connection is closed or the context is canceled.
+func (c *conn) acceptStreams(ctx context.Context) {
+	for {
+		str, err := c.AcceptStream(ctx)
+		if err != nil {
+			return
+		}
+		c.streamAccepted(str.StreamID())
+		go c.handleStream(ctx, str)
+	}
+}
+
+// handleStream reads the first frame of a bidirectional stream opened by the
+// peer. A HEADERS frame starts a new request on the server side, a
+// WEBTRANSPORT_STREAM signal value starts a WebTransport stream of an existing
+// session.
+func (c *conn) handleStream(ctx context.Context, str quic.Stream) {
+	// Streams of this session ID are rejected unless the stream became a
+	// session
+	defer c.requestDone(str.StreamID())
+
+	frame := h3.Frame{}
+	if err := frame.ReadMax(str, maxHeadersFrameLen); err != nil {
+		code := quic.StreamErrorCode(h3.H3_REQUEST_INCOMPLETE)
+		if err == h3.ErrFrameTooLarge {
+			code = h3.H3_EXCESSIVE_LOAD
+		}
+		str.CancelRead(code)
+		str.CancelWrite(code)
+		return
+	}
+
+	switch {
+	case frame.Type == h3.FRAME_HEADERS && c.server != nil:
+		if c.requestRejected(str.StreamID()) {
+			str.CancelRead(h3.H3_REQUEST_REJECTED)
+			str.CancelWrite(h3.H3_REQUEST_REJECTED)
+			return
+		}
+		c.server.handleRequest(ctx, c, str, frame)
+	case frame.Type == h3.FRAME_WEBTRANSPORT_STREAM:
+		c.routeStream(pendingStream{
+			sessionID: quic.StreamID(frame.SessionID),
+			bidi:      str,
+		})
+	default:
+		str.CancelRead(h3.H3_FRAME_UNEXPECTED)
+		str.CancelWrite(h3.H3_FRAME_UNEXPECTED)
+	}
+}
+
+// waitSettings blocks until the peer SETTINGS frame has been received. It
+// returns false if the connection is closed or the context is canceled first.
+func (c *conn) waitSettings(ctx context.Context) bool {
+	select {
+	case <-c.settingsReceived:
+		return true
+	case <-c.Context().Done():
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// routeStream passes a WebTransport stream to the accept queue of its
+// session. Streams of sessions which are not established yet are buffered
+// until the session is added, or rejected if too many are buffered. Streams
+// whose session ID is not the ID of a session, e.g. the ID of an ordinary
+// HTTP/3 request, are rejected with the H3_ID_ERROR error code.
+func (c *conn) routeStream(p pendingStream) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.sessions[p.sessionID]; ok {
+		s.pushStream(p)
+		return
+	}
+
+	// The session may still be established on a request stream which is
+	// being handled, or, on the server side, on a request stream which was
+	// not accepted yet
+	_, isRequest := c.requests[p.sessionID]
+	notAccepted := c.server != nil && p.sessionID >= c.nextStreamID
+	if !isSessionID(p.sessionID) || !isRequest && !notAccepted {
+		p.reset(h3.H3_ID_ERROR)
+		return
+	}
+
+	if len(c.pending) >= maxBufferedStreams {
+		p.reset(h3.WEBTRANSPORT_BUFFERED_STREAM_REJECTED)
+		return
+	}
+	c.pending = append(c.pending, p)
+}
+
+// receiveDatagrams receives datagrams until the connection is closed and
+// passes each one to the session identified by its quarter stream ID.
+func (c *conn) receiveDatagrams() {
+	for {
+		msg, err := c.ReceiveDatagram(c.Context())
+		if err != nil {
+			return
+		}
+
+		// Read the "quarter stream ID" of the associated request stream
+		// from the beginning of the datagram
+		quarterStreamID, err := quicvarint.Read(bytes.NewReader(msg))
+		if err != nil {
+			continue
+		}
+		s := c.session(quic.StreamID(quarterStreamID * 4))
+		if s == nil {
+			continue
+		}
+		s.touch()
+
+		// Drop the datagram if the session does not keep up
+		select {
+		case s.datagrams <- msg[quicvarint.Len(quarterStreamID):]:
+		default:
+		}
+	}
+}
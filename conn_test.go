@@ -0,0 +1,212 @@
+package webtransport
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// dialConn dials a connection to the test server at the URL and sets it up as
+// Dialer.Dial does, sending the settings, so that a test can establish
+// several sessions on it. If settings is nil, draft-07 is advertised.
+func dialConn(t *testing.T, url string, settings h3.SettingsMap) *conn {
+	t.Helper()
+	qconn := dialQUIC(t, url)
+	c := newConn(nil, qconn)
+	if settings == nil {
+		settings = h3.SettingsMap{
+			h3.SETTINGS_H3_DATAGRAM:      1,
+			h3.WEBTRANSPORT_MAX_SESSIONS: 1,
+		}
+	}
+	if err := c.openControlStream(settings); err != nil {
+		t.Fatal(err)
+	}
+	go c.acceptUniStreams()
+	go c.receiveDatagrams()
+	go c.acceptStreams(qconn.Context())
+	if !c.waitSettings(testContext(t)) {
+		t.Fatal("no server SETTINGS received")
+	}
+	return c
+}
+
+// sendConnect sends an extended CONNECT request with the header to the URL
+// on a new request stream of the connection and reads the response.
+func sendConnect(t *testing.T, c *conn, urlStr string,
+	header http.Header) (quic.Stream, *http.Response) {
+
+	t.Helper()
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	str, err := c.OpenStreamSync(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.addRequest(str.StreamID())
+	if header == nil {
+		header = http.Header{}
+	}
+	req := &http.Request{Method: http.MethodConnect, URL: u, Header: header,
+		Host: u.Host}
+	if err := h3.WriteRequestHeaders(str, req, "webtransport"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := readResponse(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return str, resp
+}
+
+// connectSession establishes a draft-07 session on the connection with an
+// extended CONNECT request to the URL.
+func connectSession(t *testing.T, c *conn, urlStr string) *Session {
+	t.Helper()
+	str, resp := sendConnect(t, c, urlStr, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("session rejected with status %d", resp.StatusCode)
+	}
+	s := newSession(c, str, Draft07, c.Context())
+	c.addSession(s, 1)
+	go s.watchRequestStream()
+	return s
+}
+
+// acceptedSession returns the next session accepted by the test server.
+func acceptedSession(t *testing.T, sessions <-chan *Session) *Session {
+	t.Helper()
+	select {
+	case s := <-sessions:
+		return s
+	case <-testContext(t).Done():
+		t.Fatal("the server did not accept the session")
+		return nil
+	}
+}
+
+func TestMultipleSessionsPerConnection(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{MaxSessionsPerConnection: 4})
+	c := dialConn(t, url, nil)
+	if v := c.peerSettings[h3.WEBTRANSPORT_MAX_SESSIONS]; v != 4 {
+		t.Fatalf("server advertised %d sessions, want 4", v)
+	}
+
+	client1 := connectSession(t, c, url+"/one")
+	server1 := acceptedSession(t, sessions)
+	client2 := connectSession(t, c, url+"/two")
+	server2 := acceptedSession(t, sessions)
+	if server1.StreamID() == server2.StreamID() {
+		t.Fatal("both sessions have the same ID")
+	}
+
+	// Streams reach the session they were opened on
+	for _, tt := range []struct{ client, server *Session }{
+		{client2, server2},
+		{client1, server1},
+	} {
+		str, err := tt.client.OpenStream()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := str.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		accepted, err := tt.server.AcceptStream()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accepted.SessionID() != tt.server.StreamID() {
+			t.Fatalf("stream of session %d accepted by session %d",
+				accepted.SessionID(), tt.server.StreamID())
+		}
+	}
+
+	// So do datagrams
+	if err := client2.SendDatagram([]byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server2.ReceiveDatagram(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != "two" {
+		t.Fatalf("got datagram %q, want %q", msg, "two")
+	}
+}
+
+func TestStreamHeadersTooLarge(t *testing.T) {
+	url := startServer(t, &Server{})
+	qconn := dialQUIC(t, url)
+
+	// A request HEADERS frame announcing 2^61 bytes resets the stream
+	str, err := qconn.OpenStreamSync(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := quicvarint.Append(nil, h3.FRAME_HEADERS)
+	b = quicvarint.Append(b, 1<<61)
+	if _, err := str.Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = str.Read(make([]byte, 1))
+	streamErr, ok := err.(*quic.StreamError)
+	if !ok || streamErr.ErrorCode != h3.H3_EXCESSIVE_LOAD {
+		t.Fatalf("got %v, want a reset with H3_EXCESSIVE_LOAD", err)
+	}
+}
+
+// streamReset reads from the stream until it is reset and returns the error
+// code of the reset.
+func streamReset(t *testing.T, str quic.Stream) quic.StreamErrorCode {
+	t.Helper()
+	str.SetReadDeadline(time.Now().Add(testTimeout))
+	_, err := str.Read(make([]byte, 1))
+	var streamErr *quic.StreamError
+	if !errors.As(err, &streamErr) {
+		t.Fatalf("got %v, want a stream reset", err)
+	}
+	return streamErr.ErrorCode
+}
+
+func TestStreamOwnership(t *testing.T) {
+	url := startServer(t, &Server{})
+	qconn := dialQUIC(t, url)
+
+	open := func(b []byte) quic.Stream {
+		str, err := qconn.OpenStreamSync(testContext(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := str.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		return str
+	}
+	wtStream := func(sessionID uint64) []byte {
+		b := quicvarint.Append(nil, h3.FRAME_WEBTRANSPORT_STREAM)
+		return quicvarint.Append(b, sessionID)
+	}
+
+	// A session ID which is not a client bidirectional stream ID
+	if code := streamReset(t, open(wtStream(2))); code != h3.H3_ID_ERROR {
+		t.Fatalf("got error code %#x, want H3_ID_ERROR", code)
+	}
+	// The ID of the stream above, which did not become a session
+	if code := streamReset(t, open(wtStream(0))); code != h3.H3_ID_ERROR {
+		t.Fatalf("got error code %#x, want H3_ID_ERROR", code)
+	}
+	// Neither a request nor a WebTransport stream
+	if code := streamReset(t, open(frame(h3.FRAME_DATA, []byte("x")))); code != h3.H3_FRAME_UNEXPECTED {
+		t.Fatalf("got error code %#x, want H3_FRAME_UNEXPECTED", code)
+	}
+}
@@ -16,12 +16,6 @@ import (
 
 var ErrSTreamClosed = fmt.Errorf("webtransport stream closed")
 
-// datagramMessage is a helper struct for ReceiveDatagram.
-type datagramMessage struct {
-	msg []byte
-	err error
-}
-
 // SendDatagram sends a datagram over a WebTransport session. It use the
 // WebTransport session's Context() so that ending the WebTransport session
 // automatically cancels this call.
@@ -47,6 +41,7 @@ func (s *Session) SendDatagram(msg []byte) error {
 	buf.Write(msg)
 
 	// Send the buffer
+	s.touch()
 	return s.Session.SendDatagram(buf.Bytes())
 }
 
@@ -67,34 +62,19 @@ func (s *Session) SendDatagram(msg []byte) error {
 // stream, as per:
 // https://datatracker.ietf.org/doc/html/draft-ietf-masque-h3-datagram
 func (s *Session) ReceiveDatagram(ctx context.Context) ([]byte, error) {
-	resultChannel := make(chan datagramMessage)
-
-	go func() {
-		// Receive the datagram from the WebTransport session
-		msg, err := s.Session.ReceiveDatagram(ctx)
-		resultChannel <- datagramMessage{msg: msg, err: err}
-	}()
-
+	// The connection has already removed the "quarter stream ID" of the
+	// associated request stream from the beginning of the datagram and
+	// routed it to this session.
 	select {
-	case result := <-resultChannel:
-		// If an error occurred, return it
-		if result.err != nil {
-			return nil, result.err
-		}
-
-		// The datagram is a sequence of bytes that is sent in a single UDP packet.
-		// We need to read the "quarter stream ID" of the associated request stream
-		// from the beginning of the datagram, and return the rest of the datagram.
-		datastream := bytes.NewReader(result.msg)
-		quarterStreamId, err := quicvarint.Read(datastream)
-		if err != nil {
-			return nil, err
-		}
-
-		return result.msg[quicvarint.Len(quarterStreamId):], nil
+	case msg := <-s.datagrams:
+		return msg, nil
 
 	case <-ctx.Done():
 		// If the context was canceled, return ErrSTreamClosed
 		return nil, ErrSTreamClosed
+
+	case <-s.context.Done():
+		// If the session was closed, return ErrSTreamClosed
+		return nil, ErrSTreamClosed
 	}
 }
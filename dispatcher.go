@@ -0,0 +1,211 @@
+// Copyright 2025 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Unidirectional stream dispatcher module of webtransport package.
+
+package webtransport
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// maxGoAwayFrameLen is the maximum length of a GOAWAY frame payload, which is
+// a single variable-length integer.
+const maxGoAwayFrameLen = 8
+
+// acceptUniStreams accepts unidirectional streams opened by the peer until
+// the connection is closed.
+func (c *conn) acceptUniStreams() {
+	for {
+		str, err := c.AcceptUniStream(c.Context())
+		if err != nil {
+			return
+		}
+		go c.handleUniStream(str)
+	}
+}
+
+// handleUniStream reads the stream header of a unidirectional stream opened
+// by the peer and dispatches the stream by its type: the control stream and
+// the QPACK streams are handled by the connection, WebTransport streams are
+// passed to the session which owns them. Streams of unknown type are ignored,
+// as required by RFC 9114.
+func (c *conn) handleUniStream(str quic.ReceiveStream) {
+	streamHeader := h3.StreamHeader{}
+	if err := streamHeader.Read(str); err != nil {
+		// Abort reading streams of unknown type (h3.ErrUnknownStreamType),
+		// see https://www.rfc-editor.org/rfc/rfc9114.html#section-6.2-7
+		str.CancelRead(h3.H3_STREAM_CREATION_ERROR)
+		return
+	}
+
+	switch streamHeader.Type {
+	case h3.STREAM_CONTROL:
+		c.handleControlStream(str)
+	case h3.STREAM_QPACK_ENCODER:
+		c.handleQPACKStream(str, &c.peerEncoderStream)
+	case h3.STREAM_QPACK_DECODER:
+		c.handleQPACKStream(str, &c.peerDecoderStream)
+	case h3.STREAM_PUSH:
+		// Clients never push, and servers may not push as no MAX_PUSH_ID
+		// frame is sent
+		if c.server != nil {
+			c.CloseWithError(h3.H3_STREAM_CREATION_ERROR, "push stream from client")
+		} else {
+			c.CloseWithError(h3.H3_ID_ERROR, "push stream without MAX_PUSH_ID")
+		}
+	case h3.STREAM_WEBTRANSPORT_UNI_STREAM:
+		c.routeStream(pendingStream{
+			sessionID: quic.StreamID(streamHeader.ID),
+			uni:       str,
+		})
+	}
+}
+
+// handleControlStream reads the peer control stream until it is closed: first
+// the SETTINGS frame, then any GOAWAY frames. Closing the control stream is a
+// connection error.
+func (c *conn) handleControlStream(str quic.ReceiveStream) {
+	c.mu.Lock()
+	if c.peerControlStream != nil {
+		c.mu.Unlock()
+		c.CloseWithError(h3.H3_STREAM_CREATION_ERROR, "duplicate control stream")
+		return
+	}
+	c.peerControlStream = str
+	c.mu.Unlock()
+
+	if !c.readPeerSettings(str) {
+		return
+	}
+
+	qr := quicvarint.NewReader(str)
+	for {
+		t, err := quicvarint.Read(qr)
+		if err != nil {
+			c.CloseWithError(h3.H3_CLOSED_CRITICAL_STREAM, "control stream closed")
+			return
+		}
+		l, err := quicvarint.Read(qr)
+		if err != nil {
+			c.CloseWithError(h3.H3_CLOSED_CRITICAL_STREAM, "control stream closed")
+			return
+		}
+
+		switch t {
+		case h3.FRAME_GOAWAY:
+			if l > maxGoAwayFrameLen {
+				c.CloseWithError(h3.H3_FRAME_ERROR, "invalid GOAWAY frame")
+				return
+			}
+			data := make([]byte, l)
+			if _, err := io.ReadFull(str, data); err != nil {
+				c.CloseWithError(h3.H3_CLOSED_CRITICAL_STREAM, "control stream closed")
+				return
+			}
+			id, err := quicvarint.Read(bytes.NewReader(data))
+			if err != nil {
+				c.CloseWithError(h3.H3_FRAME_ERROR, "invalid GOAWAY frame")
+				return
+			}
+			if !c.peerGoAway(id) {
+				c.CloseWithError(h3.H3_ID_ERROR, "GOAWAY ID increased")
+				return
+			}
+		case h3.FRAME_SETTINGS, h3.FRAME_DATA, h3.FRAME_HEADERS,
+			h3.FRAME_PUSH_PROMISE:
+			c.CloseWithError(h3.H3_FRAME_UNEXPECTED, "unexpected frame on control stream")
+			return
+		default:
+			// CANCEL_PUSH and MAX_PUSH_ID are ignored as push is not
+			// used, unknown frame types are skipped
+			if _, err := io.CopyN(io.Discard, str, int64(l)); err != nil {
+				c.CloseWithError(h3.H3_CLOSED_CRITICAL_STREAM, "control stream closed")
+				return
+			}
+		}
+	}
+}
+
+// readPeerSettings reads the SETTINGS frame, which must be the first frame on
+// the peer control stream. It returns false and closes the connection if the
+// SETTINGS frame is missing or invalid.
+func (c *conn) readPeerSettings(str quic.ReceiveStream) bool {
+	settingsFrame := h3.Frame{}
+	err := settingsFrame.ReadMax(str, h3.MAX_SETTINGS_FRAME_LEN)
+	if err == h3.ErrFrameTooLarge {
+		c.CloseWithError(h3.H3_EXCESSIVE_LOAD, "SETTINGS frame too large")
+		return false
+	}
+	if err != nil || settingsFrame.Type != h3.FRAME_SETTINGS {
+		c.CloseWithError(h3.H3_MISSING_SETTINGS, "missing settings")
+		return false
+	}
+	peerSettings := h3.SettingsMap{}
+	if err := peerSettings.FromFrame(settingsFrame); err != nil {
+		c.CloseWithError(h3.H3_SETTINGS_ERROR, err.Error())
+		return false
+	}
+
+	// HTTP datagrams require QUIC datagram support
+	// https://www.rfc-editor.org/rfc/rfc9297.html#section-2.1.1
+	if peerSettings[h3.SETTINGS_H3_DATAGRAM] == 1 &&
+		!c.ConnectionState().SupportsDatagrams {
+		c.CloseWithError(h3.H3_SETTINGS_ERROR,
+			"H3_DATAGRAM without QUIC datagram support")
+		return false
+	}
+
+	c.peerSettings = peerSettings
+	close(c.settingsReceived)
+	return true
+}
+
+// peerGoAway handles a GOAWAY frame received from the peer. A server sends
+// GOAWAY when it is shutting down, so the client tells all its sessions on
+// the connection to drain. It returns false if the GOAWAY ID is greater than
+// the ID of a previous GOAWAY frame.
+func (c *conn) peerGoAway(id uint64) bool {
+	c.mu.Lock()
+	if c.peerGoingAway && id > c.peerGoAwayID {
+		c.mu.Unlock()
+		return false
+	}
+	c.peerGoingAway = true
+	c.peerGoAwayID = id
+	var sessions []*Session
+	if c.server == nil {
+		for _, s := range c.sessions {
+			sessions = append(sessions, s)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, s := range sessions {
+		s.drainSession()
+	}
+	return true
+}
+
+// handleQPACKStream discards the contents of a QPACK encoder or decoder stream
+// of the peer. The dynamic table is not used, so the stream carries nothing of
+// interest, but it is a critical stream and must stay open.
+func (c *conn) handleQPACKStream(str quic.ReceiveStream, stored *quic.ReceiveStream) {
+	c.mu.Lock()
+	if *stored != nil {
+		c.mu.Unlock()
+		c.CloseWithError(h3.H3_STREAM_CREATION_ERROR, "duplicate QPACK stream")
+		return
+	}
+	*stored = str
+	c.mu.Unlock()
+
+	io.Copy(io.Discard, str)
+	c.CloseWithError(h3.H3_CLOSED_CRITICAL_STREAM, "QPACK stream closed")
+}
@@ -0,0 +1,209 @@
+package webtransport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// dialQUIC dials a plain HTTP/3 QUIC connection to the test server at the
+// URL, so that a test can send the frames itself.
+func dialQUIC(t *testing.T, url string) quic.Connection {
+	t.Helper()
+	qconn, err := quic.DialAddr(testContext(t), strings.TrimPrefix(url, "https://"),
+		&tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h3"}},
+		&quic.Config{EnableDatagrams: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { qconn.CloseWithError(0, "") })
+	return qconn
+}
+
+// connectionError waits until the connection is closed and returns the error
+// code of the application error it was closed with.
+func connectionError(t *testing.T, qconn quic.Connection) quic.ApplicationErrorCode {
+	t.Helper()
+	select {
+	case <-qconn.Context().Done():
+	case <-testContext(t).Done():
+		t.Fatal("the connection was not closed")
+	}
+	var appErr *quic.ApplicationError
+	if !errors.As(context.Cause(qconn.Context()), &appErr) {
+		t.Fatalf("connection closed with %v", context.Cause(qconn.Context()))
+	}
+	return appErr.ErrorCode
+}
+
+func TestPeerSettingsTooLarge(t *testing.T) {
+	url := startServer(t, &Server{})
+	qconn := dialQUIC(t, url)
+
+	// A SETTINGS frame announcing 2^61 bytes closes the connection instead of
+	// being allocated
+	str, err := qconn.OpenUniStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := quicvarint.Append(nil, h3.STREAM_CONTROL)
+	b = quicvarint.Append(b, h3.FRAME_SETTINGS)
+	b = quicvarint.Append(b, 1<<61)
+	if _, err := str.Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := connectionError(t, qconn); code != h3.H3_EXCESSIVE_LOAD {
+		t.Fatalf("got error code %#x, want H3_EXCESSIVE_LOAD", code)
+	}
+}
+
+func TestPeerSettingsInvalid(t *testing.T) {
+	url := startServer(t, &Server{})
+	qconn := dialQUIC(t, url)
+
+	// HTTP/2 settings are not allowed in HTTP/3
+	str, err := qconn.OpenUniStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := quicvarint.Append(nil, 0x02) // SETTINGS_ENABLE_PUSH
+	settings = quicvarint.Append(settings, 0)
+	b := quicvarint.Append(nil, h3.STREAM_CONTROL)
+	b = quicvarint.Append(b, h3.FRAME_SETTINGS)
+	b = quicvarint.Append(b, uint64(len(settings)))
+	if _, err := str.Write(append(b, settings...)); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := connectionError(t, qconn); code != h3.H3_SETTINGS_ERROR {
+		t.Fatalf("got error code %#x, want H3_SETTINGS_ERROR", code)
+	}
+}
+
+func TestSessionPeerSettings(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	if v := server.PeerSettings()[h3.ENABLE_WEBTRANSPORT]; v != 1 {
+		t.Errorf("server side: ENABLE_WEBTRANSPORT = %d, want 1", v)
+	}
+	if v := client.PeerSettings()[h3.SETTINGS_ENABLE_CONNECT_PROTOCOL]; v != 1 {
+		t.Errorf("client side: SETTINGS_ENABLE_CONNECT_PROTOCOL = %d, want 1", v)
+	}
+}
+
+// uniStream opens a unidirectional stream on the connection and writes the
+// stream type and the frames to it.
+func uniStream(t *testing.T, qconn quic.Connection, streamType uint64,
+	frames ...[]byte) quic.SendStream {
+
+	t.Helper()
+	str, err := qconn.OpenUniStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := quicvarint.Append(nil, streamType)
+	for _, f := range frames {
+		b = append(b, f...)
+	}
+	if _, err := str.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	return str
+}
+
+// frame returns a frame of the type with the payload.
+func frame(t uint64, payload []byte) []byte {
+	b := quicvarint.Append(nil, t)
+	b = quicvarint.Append(b, uint64(len(payload)))
+	return append(b, payload...)
+}
+
+// emptySettings is an empty SETTINGS frame.
+var emptySettings = frame(h3.FRAME_SETTINGS, nil)
+
+func TestControlStreamErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		open func(t *testing.T, qconn quic.Connection)
+		code quic.ApplicationErrorCode
+	}{
+		{"missing settings", func(t *testing.T, qconn quic.Connection) {
+			uniStream(t, qconn, h3.STREAM_CONTROL, frame(h3.FRAME_GOAWAY, []byte{0}))
+		}, h3.H3_MISSING_SETTINGS},
+		{"second settings", func(t *testing.T, qconn quic.Connection) {
+			uniStream(t, qconn, h3.STREAM_CONTROL, emptySettings, emptySettings)
+		}, h3.H3_FRAME_UNEXPECTED},
+		{"duplicate control stream", func(t *testing.T, qconn quic.Connection) {
+			uniStream(t, qconn, h3.STREAM_CONTROL, emptySettings)
+			uniStream(t, qconn, h3.STREAM_CONTROL, emptySettings)
+		}, h3.H3_STREAM_CREATION_ERROR},
+		{"closed control stream", func(t *testing.T, qconn quic.Connection) {
+			uniStream(t, qconn, h3.STREAM_CONTROL, emptySettings).Close()
+		}, h3.H3_CLOSED_CRITICAL_STREAM},
+		{"invalid GOAWAY", func(t *testing.T, qconn quic.Connection) {
+			uniStream(t, qconn, h3.STREAM_CONTROL, emptySettings,
+				frame(h3.FRAME_GOAWAY, make([]byte, 9)))
+		}, h3.H3_FRAME_ERROR},
+		{"push stream", func(t *testing.T, qconn quic.Connection) {
+			uniStream(t, qconn, h3.STREAM_CONTROL, emptySettings)
+			uniStream(t, qconn, h3.STREAM_PUSH, []byte{0}) // push ID
+		}, h3.H3_STREAM_CREATION_ERROR},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			url := startServer(t, &Server{})
+			qconn := dialQUIC(t, url)
+			tt.open(t, qconn)
+			if code := connectionError(t, qconn); code != tt.code {
+				t.Fatalf("got error code %#x, want %#x", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestUnknownStreamTypeIgnored(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	c := dialConn(t, url, nil)
+
+	// A stream of a reserved type is ignored and the connection is still
+	// usable
+	str, err := c.OpenUniStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := str.Write(quicvarint.Append(nil, 0x21)); err != nil {
+		t.Fatal(err)
+	}
+	connectSession(t, c, url+"/wt")
+	acceptedSession(t, sessions)
+}
+
+func TestRequestWithoutWebTransportSettings(t *testing.T) {
+	url, _ := startSessionServer(t, &Server{})
+	c := dialConn(t, url, h3.SettingsMap{})
+
+	// A WebTransport request from a client which did not advertise
+	// WebTransport closes the connection
+	str, err := c.OpenStreamSync(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodConnect, url+"/wt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h3.WriteRequestHeaders(str, req, "webtransport"); err != nil {
+		t.Fatal(err)
+	}
+	if code := connectionError(t, c.Connection); code != h3.H3_SETTINGS_ERROR {
+		t.Fatalf("got error code %#x, want H3_SETTINGS_ERROR", code)
+	}
+}
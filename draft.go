@@ -0,0 +1,67 @@
+// Copyright 2025 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Draft module of webtransport package.
+
+package webtransport
+
+import (
+	"fmt"
+
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// Draft is a version of the WebTransport over HTTP/3 draft negotiated for a
+// WebTransport session.
+type Draft int
+
+// Supported WebTransport over HTTP/3 drafts.
+const (
+	// Draft02 is draft-ietf-webtrans-http3-02. It is negotiated with the
+	// ENABLE_WEBTRANSPORT and H3_DATAGRAM_05 settings, and the server confirms
+	// it with the sec-webtransport-http3-draft response header.
+	// https://www.ietf.org/archive/id/draft-ietf-webtrans-http3-02.html
+	Draft02 Draft = 2
+
+	// Draft07 is draft-ietf-webtrans-http3-07. It is negotiated with the
+	// WEBTRANSPORT_MAX_SESSIONS and RFC 9297 H3_DATAGRAM settings and uses the
+	// capsule protocol on the CONNECT stream.
+	// https://www.ietf.org/archive/id/draft-ietf-webtrans-http3-07.html
+	Draft07 Draft = 7
+
+	// Draft09 is draft-ietf-webtrans-http3-09. It is negotiated as Draft07,
+	// with the peer also advertising the initial flow control limits of
+	// sessions in the WT_INITIAL_MAX_* settings, and adds the flow control
+	// capsules on the CONNECT stream.
+	// https://www.ietf.org/archive/id/draft-ietf-webtrans-http3-09.html
+	Draft09 Draft = 9
+)
+
+// String returns a human-readable representation of the draft.
+func (d Draft) String() string {
+	return fmt.Sprintf("draft-%02d", int(d))
+}
+
+// negotiateDraft returns the newest draft supported by both this package and
+// the peer which sent the given SETTINGS. It returns false if there is no
+// such draft.
+func negotiateDraft(settings h3.SettingsMap) (Draft, bool) {
+	_, hasData := settings[h3.SETTINGS_WT_INITIAL_MAX_DATA]
+	_, hasBidi := settings[h3.SETTINGS_WT_INITIAL_MAX_STREAMS_BIDI]
+	_, hasUni := settings[h3.SETTINGS_WT_INITIAL_MAX_STREAMS_UNI]
+	flowControl := hasData || hasBidi || hasUni
+
+	switch {
+	case settings[h3.WEBTRANSPORT_MAX_SESSIONS] > 0 &&
+		settings[h3.SETTINGS_H3_DATAGRAM] == 1 && flowControl:
+		return Draft09, true
+	case settings[h3.WEBTRANSPORT_MAX_SESSIONS] > 0 &&
+		settings[h3.SETTINGS_H3_DATAGRAM] == 1:
+		return Draft07, true
+	case settings[h3.ENABLE_WEBTRANSPORT] == 1 &&
+		(settings[h3.H3_DATAGRAM_05] == 1 || settings[h3.SETTINGS_H3_DATAGRAM] == 1):
+		return Draft02, true
+	}
+	return 0, false
+}
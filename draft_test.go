@@ -0,0 +1,112 @@
+package webtransport
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+func TestNegotiateDraft(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		settings h3.SettingsMap
+		draft    Draft
+		ok       bool
+	}{
+		{"none", h3.SettingsMap{}, 0, false},
+		{"draft-02", h3.SettingsMap{
+			h3.ENABLE_WEBTRANSPORT: 1,
+			h3.H3_DATAGRAM_05:      1,
+		}, Draft02, true},
+		{"draft-02 without datagrams", h3.SettingsMap{
+			h3.ENABLE_WEBTRANSPORT: 1,
+		}, 0, false},
+		{"draft-07", h3.SettingsMap{
+			h3.WEBTRANSPORT_MAX_SESSIONS: 1,
+			h3.SETTINGS_H3_DATAGRAM:      1,
+		}, Draft07, true},
+		{"draft-09", h3.SettingsMap{
+			h3.WEBTRANSPORT_MAX_SESSIONS:    1,
+			h3.SETTINGS_H3_DATAGRAM:         1,
+			h3.SETTINGS_WT_INITIAL_MAX_DATA: 1000,
+		}, Draft09, true},
+		{"flow control without draft-07", h3.SettingsMap{
+			h3.ENABLE_WEBTRANSPORT:                  1,
+			h3.H3_DATAGRAM_05:                       1,
+			h3.SETTINGS_WT_INITIAL_MAX_STREAMS_BIDI: 10,
+		}, Draft02, true},
+		{"every draft", h3.SettingsMap{
+			h3.ENABLE_WEBTRANSPORT:                 1,
+			h3.H3_DATAGRAM_05:                      1,
+			h3.WEBTRANSPORT_MAX_SESSIONS:           1,
+			h3.SETTINGS_H3_DATAGRAM:                1,
+			h3.SETTINGS_WT_INITIAL_MAX_STREAMS_UNI: 10,
+		}, Draft09, true},
+	} {
+		draft, ok := negotiateDraft(tt.settings)
+		if draft != tt.draft || ok != tt.ok {
+			t.Errorf("%s: got %v, %v, want %v, %v", tt.name, draft, ok,
+				tt.draft, tt.ok)
+		}
+	}
+}
+
+func TestSessionDraft(t *testing.T) {
+	// Both sides advertise every draft, so the newest one is used
+	url, sessions := startSessionServer(t, &Server{})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+	if client.Draft() != Draft09 || server.Draft() != Draft09 {
+		t.Fatalf("got %v on the client and %v on the server, want %v",
+			client.Draft(), server.Draft(), Draft09)
+	}
+	if !server.flowControl.enabled {
+		t.Fatal("flow control is not enabled")
+	}
+}
+
+func TestDraftString(t *testing.T) {
+	if s := Draft02.String(); s != "draft-02" {
+		t.Fatalf("got %q, want %q", s, "draft-02")
+	}
+}
+
+func TestSessionDraft02(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	c := dialConn(t, url, h3.SettingsMap{
+		h3.ENABLE_WEBTRANSPORT: 1,
+		h3.H3_DATAGRAM_05:      1,
+	})
+	_, resp := sendConnect(t, c, url+"/wt",
+		http.Header{"Sec-Webtransport-Http3-Draft02": {"1"}})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("session rejected with status %d", resp.StatusCode)
+	}
+
+	// The server confirms draft-02 in the response
+	if v := resp.Header.Get("sec-webtransport-http3-draft"); v != "draft02" {
+		t.Fatalf("got sec-webtransport-http3-draft %q, want draft02", v)
+	}
+	if server := acceptedSession(t, sessions); server.Draft() != Draft02 {
+		t.Fatalf("got %v, want %v", server.Draft(), Draft02)
+	}
+}
+
+func TestSessionDraft07(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	c := dialConn(t, url, nil)
+	_, resp := sendConnect(t, c, url+"/wt", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("session rejected with status %d", resp.StatusCode)
+	}
+	if resp.Header.Get("sec-webtransport-http3-draft") != "" {
+		t.Fatal("draft-02 confirmed for a draft-07 session")
+	}
+	server := acceptedSession(t, sessions)
+	if server.Draft() != Draft07 {
+		t.Fatalf("got %v, want %v", server.Draft(), Draft07)
+	}
+	if server.flowControl.enabled {
+		t.Fatal("flow control enabled for a draft-07 session")
+	}
+}
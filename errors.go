@@ -0,0 +1,159 @@
+// Copyright 2025 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Errors module of webtransport package.
+
+package webtransport
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/quic-go/quic-go"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// ErrSessionNotAccepted is returned when a capsule is sent on a WebTransport
+// session which was not accepted yet.
+var ErrSessionNotAccepted = fmt.Errorf("webtransport session not accepted")
+
+// SessionErrorCode is a WebTransport application error code used when closing
+// a session.
+type SessionErrorCode uint32
+
+// SessionCloseCause tells how a WebTransport session was closed.
+type SessionCloseCause int
+
+// Causes of a session close
+const (
+	// CloseCauseCapsule means the session was closed by a
+	// CLOSE_WEBTRANSPORT_SESSION capsule, or cleanly by closing the request
+	// stream
+	CloseCauseCapsule SessionCloseCause = iota
+	// CloseCauseConnection means the QUIC connection of the session was
+	// closed
+	CloseCauseConnection
+	// CloseCauseIdleTimeout means the session was idle for too long
+	CloseCauseIdleTimeout
+	// CloseCauseStreamReset means the request stream of the session was reset
+	// by the peer, or by the session because the peer sent a malformed
+	// capsule
+	CloseCauseStreamReset
+)
+
+// String returns the string representation of the close cause.
+func (c SessionCloseCause) String() string {
+	switch c {
+	case CloseCauseCapsule:
+		return "capsule"
+	case CloseCauseConnection:
+		return "connection close"
+	case CloseCauseIdleTimeout:
+		return "idle timeout"
+	case CloseCauseStreamReset:
+		return "request stream reset"
+	}
+	return fmt.Sprintf("unknown cause %d", int(c))
+}
+
+// SessionError describes why a WebTransport session ended. It is the cause of
+// the session Context and is returned by Session.Err.
+type SessionError struct {
+	// ErrorCode is the application error code of the session close
+	ErrorCode SessionErrorCode
+	// Message is the error message of the session close
+	Message string
+	// Remote is set if the session was closed by the peer
+	Remote bool
+	// Cause tells how the session was closed
+	Cause SessionCloseCause
+	// Err is the underlying QUIC error if the session ended because its
+	// connection was closed or its request stream was reset
+	Err error
+}
+
+// Error returns the error string.
+func (e *SessionError) Error() string {
+	remote := ""
+	if e.Remote {
+		remote = " (remote)"
+	}
+	switch {
+	case e.Cause != CloseCauseCapsule && e.Err != nil:
+		return fmt.Sprintf("webtransport session closed by %s%s: %v", e.Cause,
+			remote, e.Err)
+	case e.Cause != CloseCauseCapsule:
+		return fmt.Sprintf("webtransport session closed by %s%s", e.Cause, remote)
+	case e.Message == "":
+		return fmt.Sprintf("webtransport session error %#x%s", e.ErrorCode, remote)
+	}
+	return fmt.Sprintf("webtransport session error %#x%s: %s", e.ErrorCode,
+		remote, e.Message)
+}
+
+// Unwrap returns the underlying QUIC error.
+func (e *SessionError) Unwrap() error {
+	return e.Err
+}
+
+// StreamErrorCode is a WebTransport application error code used when
+// resetting a stream.
+type StreamErrorCode uint32
+
+// StreamError is returned by the Read and Write methods of a WebTransport
+// stream which was reset with a WebTransport application error code.
+type StreamError struct {
+	// Code is the application error code of the reset
+	Code StreamErrorCode
+	// Remote is set if the stream was reset by the peer
+	Remote bool
+}
+
+// Error returns the error string.
+func (e *StreamError) Error() string {
+	remote := ""
+	if e.Remote {
+		remote = " (remote)"
+	}
+	return fmt.Sprintf("webtransport stream reset with error code %d%s", e.Code,
+		remote)
+}
+
+// webtransportCodeToHTTPCode maps a WebTransport application error code to the
+// HTTP/3 error code sent in the QUIC stream reset. Every 0x1f-th code of the
+// range is a reserved code and is skipped.
+func webtransportCodeToHTTPCode(n StreamErrorCode) quic.StreamErrorCode {
+	return quic.StreamErrorCode(h3.WEBTRANSPORT_APPLICATION_ERROR_FIRST +
+		uint64(n) + uint64(n)/0x1e)
+}
+
+// httpCodeToWebtransportCode maps an HTTP/3 error code received in a QUIC
+// stream reset to a WebTransport application error code. It returns false if
+// the code does not carry a WebTransport application error code.
+func httpCodeToWebtransportCode(h quic.StreamErrorCode) (StreamErrorCode, bool) {
+	if h < h3.WEBTRANSPORT_APPLICATION_ERROR_FIRST ||
+		h > h3.WEBTRANSPORT_APPLICATION_ERROR_LAST {
+		return 0, false
+	}
+	// Reserved codes
+	if (uint64(h)-0x21)%0x1f == 0 {
+		return 0, false
+	}
+	shifted := uint64(h) - h3.WEBTRANSPORT_APPLICATION_ERROR_FIRST
+	return StreamErrorCode(shifted - shifted/0x1f), true
+}
+
+// streamError converts a QUIC stream error carrying a WebTransport application
+// error code to a *StreamError. Other errors are returned unchanged.
+func streamError(err error) error {
+	var quicErr *quic.StreamError
+	if !errors.As(err, &quicErr) {
+		return err
+	}
+	code, ok := httpCodeToWebtransportCode(quicErr.ErrorCode)
+	if !ok {
+		return err
+	}
+	return &StreamError{Code: code, Remote: quicErr.Remote}
+}
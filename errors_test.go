@@ -0,0 +1,122 @@
+package webtransport
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+func TestWebtransportCodeToHTTPCode(t *testing.T) {
+	for _, tt := range []struct {
+		code StreamErrorCode
+		http quic.StreamErrorCode
+	}{
+		{0, h3.WEBTRANSPORT_APPLICATION_ERROR_FIRST},
+		{0x1d, h3.WEBTRANSPORT_APPLICATION_ERROR_FIRST + 0x1d},
+		// The reserved code FIRST+0x1e is skipped
+		{0x1e, h3.WEBTRANSPORT_APPLICATION_ERROR_FIRST + 0x1f},
+		{0xffffffff, h3.WEBTRANSPORT_APPLICATION_ERROR_LAST},
+	} {
+		if got := webtransportCodeToHTTPCode(tt.code); got != tt.http {
+			t.Errorf("code %#x: got %#x, want %#x", tt.code, got, tt.http)
+		}
+		code, ok := httpCodeToWebtransportCode(tt.http)
+		if !ok || code != tt.code {
+			t.Errorf("HTTP code %#x: got %#x, %v, want %#x", tt.http, code, ok,
+				tt.code)
+		}
+	}
+}
+
+func TestHTTPCodeToWebtransportCodeRejected(t *testing.T) {
+	for _, h := range []quic.StreamErrorCode{
+		h3.H3_NO_ERROR,
+		h3.WEBTRANSPORT_APPLICATION_ERROR_FIRST - 1,
+		h3.WEBTRANSPORT_APPLICATION_ERROR_FIRST + 0x1e, // reserved
+		h3.WEBTRANSPORT_APPLICATION_ERROR_LAST + 1,
+	} {
+		if code, ok := httpCodeToWebtransportCode(h); ok {
+			t.Errorf("HTTP code %#x mapped to %#x", h, code)
+		}
+	}
+}
+
+func TestCodeMappingRoundTrip(t *testing.T) {
+	for _, code := range []StreamErrorCode{1, 29, 30, 31, 59, 60, 61, 1000,
+		1 << 20, 0xfffffffe} {
+		got, ok := httpCodeToWebtransportCode(webtransportCodeToHTTPCode(code))
+		if !ok || got != code {
+			t.Errorf("code %#x: got %#x, %v", code, got, ok)
+		}
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	err := streamError(&quic.StreamError{
+		ErrorCode: webtransportCodeToHTTPCode(42),
+		Remote:    true,
+	})
+	var streamErr *StreamError
+	if !errors.As(err, &streamErr) || streamErr.Code != 42 || !streamErr.Remote {
+		t.Fatalf("got %v, want a remote StreamError with code 42", err)
+	}
+
+	// Errors without a WebTransport code are returned unchanged
+	quicErr := &quic.StreamError{ErrorCode: h3.WEBTRANSPORT_SESSION_GONE}
+	if err := streamError(quicErr); err != quicErr {
+		t.Fatalf("got %v, want the QUIC error", err)
+	}
+}
+
+func TestStreamResetCode(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	str, err := client.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := str.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	accepted, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	str.CancelWrite(42)
+
+	// The peer reads the WebTransport code of the reset
+	buf := make([]byte, 16)
+	for {
+		_, err = accepted.Read(buf)
+		if err != nil {
+			break
+		}
+	}
+	var streamErr *StreamError
+	if !errors.As(err, &streamErr) || streamErr.Code != 42 || !streamErr.Remote {
+		t.Fatalf("got %v, want a remote StreamError with code 42", err)
+	}
+}
+
+func TestSessionErrorString(t *testing.T) {
+	for _, tt := range []struct {
+		err  *SessionError
+		want string
+	}{
+		{&SessionError{ErrorCode: 3}, "webtransport session error 0x3"},
+		{&SessionError{ErrorCode: 3, Message: "bye", Remote: true},
+			"webtransport session error 0x3 (remote): bye"},
+		{&SessionError{Cause: CloseCauseIdleTimeout, Message: "idle timeout"},
+			"webtransport session closed by idle timeout"},
+		{&SessionError{Cause: CloseCauseConnection, Remote: true,
+			Err: errors.New("closed")},
+			"webtransport session closed by connection close (remote): closed"},
+	} {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
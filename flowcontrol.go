@@ -0,0 +1,428 @@
+// Copyright 2025 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Flow control module of webtransport package.
+
+package webtransport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// ErrStreamLimitReached is returned by OpenStream and OpenUniStream if the
+// peer does not allow the session to open more streams.
+var ErrStreamLimitReached = fmt.Errorf("webtransport session stream limit reached")
+
+// noLimit is the flow control limit advertised when a limit is not set.
+const noLimit = quicvarint.Max
+
+// flowLimits are the flow control limits of the sessions of a connection. A
+// zero value means not limited.
+type flowLimits struct {
+	maxData        uint64
+	maxStreamsBidi uint64
+	maxStreamsUni  uint64
+}
+
+// addSettings adds the initial flow control limits to the settings. Unset
+// limits are advertised as the maximum value, so that the peer knows that
+// flow control is supported.
+func (l flowLimits) addSettings(settings h3.SettingsMap) {
+	settings[h3.SETTINGS_WT_INITIAL_MAX_DATA] = limitOrMax(l.maxData)
+	settings[h3.SETTINGS_WT_INITIAL_MAX_STREAMS_BIDI] = limitOrMax(l.maxStreamsBidi)
+	settings[h3.SETTINGS_WT_INITIAL_MAX_STREAMS_UNI] = limitOrMax(l.maxStreamsUni)
+}
+
+// limitOrMax returns the limit, or noLimit if the limit is zero.
+func limitOrMax(limit uint64) uint64 {
+	if limit == 0 {
+		return noLimit
+	}
+	return limit
+}
+
+// recvLimit is a flow control limit on the data or streams received from the
+// peer.
+type recvLimit struct {
+	window   uint64 // configured limit
+	max      uint64 // limit advertised to the peer
+	used     uint64 // streams or bytes received
+	released uint64 // bytes consumed or streams closed
+}
+
+// receive counts n received units, streams or bytes, and reports whether the
+// limit is kept.
+func (l *recvLimit) receive(n uint64) bool {
+	l.used += n
+	return l.used <= l.max
+}
+
+// release counts n consumed units. It returns the new limit when an update
+// should be sent to the peer, which is when half of the window was consumed,
+// or zero.
+func (l *recvLimit) release(n uint64) uint64 {
+	l.released += n
+	if l.window == noLimit {
+		return 0
+	}
+	newMax := l.released + l.window
+	if newMax <= l.max || newMax-l.max < (l.window+1)/2 {
+		return 0
+	}
+	l.max = newMax
+	return newMax
+}
+
+// sendLimit is a flow control limit advertised by the peer on the data or
+// streams sent to it.
+type sendLimit struct {
+	max  uint64 // limit advertised by the peer
+	used uint64 // bytes or streams sent
+}
+
+// available returns the number of units which may be sent.
+func (l *sendLimit) available() uint64 {
+	if l.used >= l.max {
+		return 0
+	}
+	return l.max - l.used
+}
+
+// flowControl is the WebTransport flow control state of a session. It is used
+// only if the session uses Draft09, that is if the peer advertised the initial
+// flow control limits in its SETTINGS.
+type flowControl struct {
+	mu      sync.Mutex
+	enabled bool
+	// changed is closed and replaced when a send limit changes
+	changed chan struct{}
+
+	recvData, recvBidi, recvUni recvLimit
+	sendData, sendBidi, sendUni sendLimit
+
+	// updates holds the highest value of each limit capsule waiting to be
+	// sent by the single limit writer, which runs while writing is set
+	updates map[uint64]uint64
+	writing bool
+}
+
+// limitCapsuleTypes are the types of the capsules sent by the limit writer,
+// in the order they are sent.
+var limitCapsuleTypes = []uint64{
+	h3.CAPSULE_WT_MAX_DATA,
+	h3.CAPSULE_WT_MAX_STREAMS_BIDI,
+	h3.CAPSULE_WT_MAX_STREAMS_UNI,
+	h3.CAPSULE_WT_DATA_BLOCKED,
+	h3.CAPSULE_WT_STREAMS_BLOCKED_BIDI,
+	h3.CAPSULE_WT_STREAMS_BLOCKED_UNI,
+}
+
+// initFlowControl sets the flow control limits of the session from the limits
+// of its connection and the peer SETTINGS.
+func (s *Session) initFlowControl() {
+	fc := &s.flowControl
+	fc.changed = make(chan struct{})
+
+	fc.enabled = s.draft == Draft09
+	if !fc.enabled {
+		return
+	}
+
+	// Limits of the peer; the limits the peer did not advertise are not
+	// applied
+	peer := s.conn.peerSettings
+	peerLimit := func(id h3.SettingID) uint64 {
+		if v, ok := peer[id]; ok {
+			return v
+		}
+		return noLimit
+	}
+	fc.sendData.max = peerLimit(h3.SETTINGS_WT_INITIAL_MAX_DATA)
+	fc.sendBidi.max = peerLimit(h3.SETTINGS_WT_INITIAL_MAX_STREAMS_BIDI)
+	fc.sendUni.max = peerLimit(h3.SETTINGS_WT_INITIAL_MAX_STREAMS_UNI)
+
+	// Own limits, as advertised in the SETTINGS
+	limits := s.conn.limits
+	for _, l := range []struct {
+		limit *recvLimit
+		value uint64
+	}{
+		{&fc.recvData, limits.maxData},
+		{&fc.recvBidi, limits.maxStreamsBidi},
+		{&fc.recvUni, limits.maxStreamsUni},
+	} {
+		l.limit.window = limitOrMax(l.value)
+		l.limit.max = l.limit.window
+	}
+}
+
+// flowControlError closes the session after the peer exceeded a flow control
+// limit: the request stream is reset with the WT_FLOW_CONTROL_ERROR error
+// code.
+func (s *Session) flowControlError() {
+	s.end(&SessionError{
+		Cause: CloseCauseStreamReset,
+		Err: &quic.StreamError{
+			StreamID:  s.StreamID(),
+			ErrorCode: h3.WT_FLOW_CONTROL_ERROR,
+		},
+	})
+	s.Stream.CancelRead(h3.WT_FLOW_CONTROL_ERROR)
+	s.Stream.CancelWrite(h3.WT_FLOW_CONTROL_ERROR)
+}
+
+// sendLimitUpdate queues a capsule raising a limit of the peer, or telling
+// the peer that the session is blocked, if the value is not zero. Capsules are
+// written in order by a single writer, and of several queued capsules of one
+// type only the one with the highest value is sent, so that the peer never
+// receives a limit lower than one it received before. It must be called with
+// the flow control mutex held.
+func (s *Session) sendLimitUpdate(capsuleType, value uint64) {
+	fc := &s.flowControl
+	if value == 0 {
+		return
+	}
+	if fc.updates == nil {
+		fc.updates = make(map[uint64]uint64)
+	}
+	fc.updates[capsuleType] = max(fc.updates[capsuleType], value)
+	if !fc.writing {
+		fc.writing = true
+		go s.writeLimitUpdates()
+	}
+}
+
+// writeLimitUpdates writes the queued limit capsules until none is left.
+func (s *Session) writeLimitUpdates() {
+	fc := &s.flowControl
+	for {
+		fc.mu.Lock()
+		updates := fc.updates
+		fc.updates = nil
+		if len(updates) == 0 {
+			fc.writing = false
+			fc.mu.Unlock()
+			return
+		}
+		fc.mu.Unlock()
+
+		for _, capsuleType := range limitCapsuleTypes {
+			if value, ok := updates[capsuleType]; ok {
+				s.writeCapsule(h3.NewVarintCapsule(capsuleType, value))
+			}
+		}
+	}
+}
+
+// incomingStream counts a stream opened by the peer. It returns false and
+// closes the session if the peer exceeded the stream limit.
+func (s *Session) incomingStream(bidi bool) bool {
+	fc := &s.flowControl
+	fc.mu.Lock()
+	ok := true
+	if fc.enabled {
+		if bidi {
+			ok = fc.recvBidi.receive(1)
+		} else {
+			ok = fc.recvUni.receive(1)
+		}
+	}
+	fc.mu.Unlock()
+
+	if !ok {
+		go s.flowControlError()
+	}
+	return ok
+}
+
+// streamClosed releases the stream limit for a closed stream if the stream was
+// opened by the peer.
+func (s *Session) streamClosed(id quic.StreamID) {
+	// Client-initiated streams have the lowest bit of the ID unset
+	clientInitiated := id&1 == 0
+	if clientInitiated != (s.conn.server != nil) {
+		return
+	}
+
+	fc := &s.flowControl
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if !fc.enabled {
+		return
+	}
+	if id&2 == 0 {
+		s.sendLimitUpdate(h3.CAPSULE_WT_MAX_STREAMS_BIDI, fc.recvBidi.release(1))
+	} else {
+		s.sendLimitUpdate(h3.CAPSULE_WT_MAX_STREAMS_UNI, fc.recvUni.release(1))
+	}
+}
+
+// limitsData reports whether the session limits the data it receives, in
+// which case the data of its streams is read through a recvBuffer as it
+// arrives.
+func (s *Session) limitsData() bool {
+	fc := &s.flowControl
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.enabled && fc.recvData.window != noLimit
+}
+
+// dataReceived counts n bytes received on a stream of the session. It returns
+// false and closes the session if the peer exceeded the data limit.
+func (s *Session) dataReceived(n int) bool {
+	s.touch()
+	fc := &s.flowControl
+	fc.mu.Lock()
+	ok := !fc.enabled || fc.recvData.receive(uint64(n))
+	fc.mu.Unlock()
+
+	if !ok {
+		go s.flowControlError()
+	}
+	return ok
+}
+
+// dataConsumed counts n received bytes which were read or dropped and raises
+// the data limit of the peer by the bytes consumed.
+func (s *Session) dataConsumed(n int) {
+	if n == 0 {
+		return
+	}
+	fc := &s.flowControl
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.enabled {
+		s.sendLimitUpdate(h3.CAPSULE_WT_MAX_DATA, fc.recvData.release(uint64(n)))
+	}
+}
+
+// reserveStream reserves a stream which the session is about to open. If the
+// peer does not allow more streams, it returns ErrStreamLimitReached, or, if
+// wait is set, blocks until the peer raises the limit or the context is done.
+func (s *Session) reserveStream(ctx context.Context, bidi, wait bool) error {
+	fc := &s.flowControl
+	limit, blockedType := &fc.sendUni, uint64(h3.CAPSULE_WT_STREAMS_BLOCKED_UNI)
+	if bidi {
+		limit, blockedType = &fc.sendBidi, h3.CAPSULE_WT_STREAMS_BLOCKED_BIDI
+	}
+
+	for {
+		fc.mu.Lock()
+		if !fc.enabled || limit.available() > 0 {
+			limit.used++
+			fc.mu.Unlock()
+			return nil
+		}
+		// Tell the peer that the session is blocked
+		s.sendLimitUpdate(blockedType, limit.max)
+		changed := fc.changed
+		fc.mu.Unlock()
+
+		if !wait {
+			return ErrStreamLimitReached
+		}
+		if err := s.waitLimit(ctx, changed); err != nil {
+			return err
+		}
+	}
+}
+
+// unreserveStream returns a stream reserved by reserveStream which the
+// session failed to open, and wakes up the callers waiting for a stream.
+func (s *Session) unreserveStream(bidi bool) {
+	fc := &s.flowControl
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	limit := &fc.sendUni
+	if bidi {
+		limit = &fc.sendBidi
+	}
+	if limit.used > 0 {
+		limit.used--
+	}
+	close(fc.changed)
+	fc.changed = make(chan struct{})
+}
+
+// reserveData reserves up to n bytes which the session is about to send,
+// blocking until the peer allows at least one byte to be sent or the context
+// is done. It returns the number of bytes which may be sent.
+func (s *Session) reserveData(ctx context.Context, n int) (int, error) {
+	fc := &s.flowControl
+	for {
+		fc.mu.Lock()
+		if !fc.enabled {
+			fc.mu.Unlock()
+			return n, nil
+		}
+		if available := fc.sendData.available(); available > 0 {
+			if uint64(n) > available {
+				n = int(available)
+			}
+			fc.sendData.used += uint64(n)
+			fc.mu.Unlock()
+			return n, nil
+		}
+		// Tell the peer that the session is blocked
+		s.sendLimitUpdate(h3.CAPSULE_WT_DATA_BLOCKED, fc.sendData.max)
+		changed := fc.changed
+		fc.mu.Unlock()
+
+		if err := s.waitLimit(ctx, changed); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// waitLimit waits until the peer raises a limit, the context is done or the
+// session ends.
+func (s *Session) waitLimit(ctx context.Context, changed chan struct{}) error {
+	select {
+	case <-changed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.context.Done():
+		return ErrSTreamClosed
+	}
+}
+
+// handleLimitCapsule applies a WT_MAX_DATA or WT_MAX_STREAMS capsule received
+// from the peer. A limit may only be raised; a capsule which does not raise
+// the limit is ignored, as a QUIC MAX_DATA frame is.
+func (s *Session) handleLimitCapsule(capsule h3.Capsule) {
+	value, err := capsule.Varint()
+	if err != nil {
+		s.flowControlError()
+		return
+	}
+
+	fc := &s.flowControl
+	fc.mu.Lock()
+	if !fc.enabled {
+		fc.mu.Unlock()
+		return
+	}
+	var limit *sendLimit
+	switch capsule.Type {
+	case h3.CAPSULE_WT_MAX_DATA:
+		limit = &fc.sendData
+	case h3.CAPSULE_WT_MAX_STREAMS_BIDI:
+		limit = &fc.sendBidi
+	default:
+		limit = &fc.sendUni
+	}
+	if value > limit.max {
+		limit.max = value
+		close(fc.changed)
+		fc.changed = make(chan struct{})
+	}
+	fc.mu.Unlock()
+}
@@ -0,0 +1,312 @@
+package webtransport
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// waitFor polls the condition until it is true and fails the test if it is
+// still false after testTimeout.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRecvLimitRelease(t *testing.T) {
+	l := recvLimit{window: 100, max: 100}
+
+	// No update until half of the window was consumed
+	if max := l.release(49); max != 0 {
+		t.Fatalf("update to %d after 49 bytes", max)
+	}
+	if max := l.release(1); max != 150 {
+		t.Fatalf("got update to %d, want 150", max)
+	}
+	if max := l.release(10); max != 0 {
+		t.Fatalf("update to %d after 10 more bytes", max)
+	}
+
+	// An unlimited window is never updated
+	l = recvLimit{window: noLimit, max: noLimit}
+	if max := l.release(1 << 40); max != 0 {
+		t.Fatalf("update to %d of an unlimited window", max)
+	}
+}
+
+func TestRecvLimitReceive(t *testing.T) {
+	l := recvLimit{window: 2, max: 2}
+	if !l.receive(1) || !l.receive(1) {
+		t.Fatal("limit exceeded within the window")
+	}
+	if l.receive(1) {
+		t.Fatal("limit not exceeded beyond the window")
+	}
+}
+
+func TestSendLimitAvailable(t *testing.T) {
+	l := sendLimit{max: 10, used: 4}
+	if n := l.available(); n != 6 {
+		t.Fatalf("got %d, want 6", n)
+	}
+	l.used = 12
+	if n := l.available(); n != 0 {
+		t.Fatalf("got %d, want 0", n)
+	}
+}
+
+func TestFlowControlData(t *testing.T) {
+	const maxData = 1000
+	url, sessions := startSessionServer(t, &Server{SessionMaxData: maxData})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	str, err := client.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("0123456789"), 5*maxData/10)
+	written := make(chan error, 1)
+	go func() {
+		_, err := str.Write(data)
+		str.Close()
+		written <- err
+	}()
+
+	// The client sends no more than the limit while the server reads nothing
+	waitFor(t, "the data limit to be used", func() bool {
+		client.flowControl.mu.Lock()
+		defer client.flowControl.mu.Unlock()
+		return client.flowControl.sendData.available() == 0
+	})
+	select {
+	case err := <-written:
+		t.Fatalf("the write beyond the limit returned %v", err)
+	default:
+	}
+
+	// Reading raises the limit, so the whole data arrives in small reads
+	// without a flow control error
+	accepted, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	buf := make([]byte, 512)
+	for {
+		n, err := accepted.Read(buf)
+		got.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got.Bytes(), data) {
+		t.Fatalf("got %d bytes, want %d", got.Len(), len(data))
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Err(); err != nil {
+		t.Fatalf("session ended with %v", err)
+	}
+}
+
+func TestFlowControlOpenFailure(t *testing.T) {
+	// QUIC allows the client the request stream and one more stream, while
+	// the session allows ten
+	url, sessions := startSessionServer(t, &Server{
+		QuicConfig:            &QuicConfig{MaxIncomingStreams: 2},
+		SessionMaxStreamsBidi: 10,
+	})
+	client, _ := dialSession(t, nil, url+"/wt", sessions)
+
+	if _, err := client.OpenStream(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.OpenStream(); err == nil {
+		t.Fatal("opened a stream beyond the QUIC stream limit")
+	}
+
+	// The stream which failed to open does not count against the limit
+	client.flowControl.mu.Lock()
+	used := client.flowControl.sendBidi.used
+	client.flowControl.mu.Unlock()
+	if used != 1 {
+		t.Fatalf("%d streams counted, want 1", used)
+	}
+}
+
+// flowControlErrorCode waits until the session ends and returns the error code
+// of the request stream reset which ended it.
+func flowControlErrorCode(t *testing.T, s *Session) quic.StreamErrorCode {
+	t.Helper()
+	e := sessionError(t, s)
+	var streamErr *quic.StreamError
+	if e.Cause != CloseCauseStreamReset || !errors.As(e, &streamErr) {
+		t.Fatalf("got %+v", e)
+	}
+	return streamErr.ErrorCode
+}
+
+func TestFlowControlDataExceeded(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{SessionMaxData: 1000})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	// The client ignores the data limit, while the server reads nothing
+	client.flowControl.mu.Lock()
+	client.flowControl.sendData.max = noLimit
+	client.flowControl.mu.Unlock()
+	str, err := client.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := str.Write(make([]byte, 5000)); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := flowControlErrorCode(t, server); code != h3.WT_FLOW_CONTROL_ERROR {
+		t.Fatalf("got error code %#x, want WT_FLOW_CONTROL_ERROR", code)
+	}
+	if code := flowControlErrorCode(t, client); code != h3.WT_FLOW_CONTROL_ERROR {
+		t.Fatalf("the client got error code %#x, want WT_FLOW_CONTROL_ERROR", code)
+	}
+}
+
+func TestFlowControlStreamsExceeded(t *testing.T) {
+	for _, bidi := range []bool{true, false} {
+		url, sessions := startSessionServer(t, &Server{
+			SessionMaxStreamsBidi: 2,
+			SessionMaxStreamsUni:  2,
+		})
+		client, server := dialSession(t, nil, url+"/wt", sessions)
+
+		// The client ignores the stream limit and opens a third stream
+		client.flowControl.mu.Lock()
+		client.flowControl.sendBidi.max = noLimit
+		client.flowControl.sendUni.max = noLimit
+		client.flowControl.mu.Unlock()
+		for range 3 {
+			var w io.Writer
+			if bidi {
+				str, err := client.OpenStream()
+				if err != nil {
+					t.Fatal(err)
+				}
+				w = str
+			} else {
+				str, err := client.OpenUniStream()
+				if err != nil {
+					t.Fatal(err)
+				}
+				w = &str
+			}
+			if _, err := w.Write([]byte("x")); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if code := flowControlErrorCode(t, server); code != h3.WT_FLOW_CONTROL_ERROR {
+			t.Fatalf("bidi %v: got error code %#x, want WT_FLOW_CONTROL_ERROR",
+				bidi, code)
+		}
+	}
+}
+
+func TestFlowControlDiscardedData(t *testing.T) {
+	const maxData = 1000
+	url, sessions := startSessionServer(t, &Server{SessionMaxData: maxData})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	str, err := client.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := str.Write(make([]byte, maxData)); err != nil {
+		t.Fatal(err)
+	}
+	accepted, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the data to be received", func() bool {
+		server.flowControl.mu.Lock()
+		defer server.flowControl.mu.Unlock()
+		return server.flowControl.recvData.used == maxData
+	})
+
+	// The data dropped by CancelRead is released, so the client may send
+	// another maxData bytes
+	accepted.CancelRead(0)
+	str, err = client.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := make(chan error, 1)
+	go func() {
+		_, err := str.Write(make([]byte, maxData))
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-testContext(t).Done():
+		t.Fatal("the discarded data was not released")
+	}
+}
+
+func TestLimitUpdatesOrdered(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{SessionMaxData: 1000})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	// Many increasing updates queued at once reach the peer without a lower
+	// limit following a higher one
+	const base = 1 << 20
+	fc := &server.flowControl
+	fc.mu.Lock()
+	for i := range 100 {
+		server.sendLimitUpdate(h3.CAPSULE_WT_MAX_DATA, base+uint64(i))
+	}
+	fc.mu.Unlock()
+
+	waitFor(t, "the limit update", func() bool {
+		client.flowControl.mu.Lock()
+		defer client.flowControl.mu.Unlock()
+		return client.flowControl.sendData.max == base+99
+	})
+	if err := client.Err(); err != nil {
+		t.Fatalf("the session ended with %v", err)
+	}
+}
+
+func TestLimitCapsuleLower(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{SessionMaxData: 1000})
+	client, _ := dialSession(t, nil, url+"/wt", sessions)
+
+	// A capsule which does not raise the limit is ignored
+	client.handleLimitCapsule(h3.NewVarintCapsule(h3.CAPSULE_WT_MAX_DATA, 10))
+	client.flowControl.mu.Lock()
+	max := client.flowControl.sendData.max
+	client.flowControl.mu.Unlock()
+	if max != 1000 {
+		t.Fatalf("got limit %d, want 1000", max)
+	}
+	if err := client.Err(); err != nil {
+		t.Fatalf("the session ended with %v", err)
+	}
+}
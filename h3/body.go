@@ -0,0 +1,109 @@
+package h3
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+var ErrFrameUnexpected = errors.New("unexpected frame on request stream")
+
+// Body reads the data of an HTTP/3 message, that is the payload of the DATA
+// frames received on a request stream. Unknown frame types are skipped. The
+// body ends when the stream ends or when a HEADERS frame carrying trailers is
+// received.
+type Body struct {
+	stream    quic.ReceiveStream
+	reader    quicvarint.Reader
+	remaining uint64 // unread payload bytes of the current DATA frame
+	err       error
+}
+
+// NewBody returns a new Body reading from the given stream. The HEADERS frame
+// of the message must already have been read from the stream.
+func NewBody(stream quic.ReceiveStream) *Body {
+	return &Body{stream: stream, reader: quicvarint.NewReader(stream)}
+}
+
+// Read reads up to len(p) bytes of the message data.
+func (b *Body) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	// Find the next DATA frame with payload
+	for b.remaining == 0 {
+		if b.err = b.nextFrame(); b.err != nil {
+			return 0, b.err
+		}
+	}
+
+	if uint64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.stream.Read(p)
+	b.remaining -= uint64(n)
+	if err == io.EOF && b.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == io.EOF {
+		// The data of the last frame has been read, report EOF on next Read
+		b.err, err = err, nil
+	} else if err != nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// nextFrame reads the next frame header from the stream. It sets the remaining
+// payload length for a DATA frame and skips the payload of any other frame.
+func (b *Body) nextFrame() error {
+	t, err := quicvarint.Read(b.reader)
+	if err != nil {
+		return err
+	}
+	l, err := quicvarint.Read(b.reader)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	switch t {
+	case FRAME_DATA:
+		b.remaining = l
+		return nil
+	case FRAME_HEADERS:
+		// Trailers end the message; they are skipped
+		if _, err := io.CopyN(io.Discard, b.stream, int64(l)); err != nil {
+			return err
+		}
+		return io.EOF
+	case FRAME_CANCEL_PUSH, FRAME_SETTINGS, FRAME_PUSH_PROMISE, FRAME_GOAWAY,
+		FRAME_MAX_PUSH_ID:
+		return ErrFrameUnexpected
+	default:
+		// Unknown frame types are skipped
+		_, err := io.CopyN(io.Discard, b.stream, int64(l))
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+}
+
+// Close stops reading the message. If the message was not read to the end,
+// the peer is asked to stop sending.
+func (b *Body) Close() error {
+	if b.err != io.EOF {
+		b.stream.CancelRead(H3_NO_ERROR)
+	}
+	if b.err == nil {
+		b.err = http.ErrBodyReadAfterClose
+	}
+	return nil
+}
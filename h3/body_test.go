@@ -0,0 +1,56 @@
+package h3
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+)
+
+// readStream is a quic.ReceiveStream reading from a reader. Only Read and
+// CancelRead may be called.
+type readStream struct {
+	quic.ReceiveStream
+	r        io.Reader
+	canceled bool
+}
+
+func (s *readStream) Read(p []byte) (int, error)      { return s.r.Read(p) }
+func (s *readStream) CancelRead(quic.StreamErrorCode) { s.canceled = true }
+
+func TestBody(t *testing.T) {
+	var buf bytes.Buffer
+	for _, f := range []Frame{
+		{Type: FRAME_DATA, Length: 5, Data: []byte("hello")},
+		{Type: 0x21, Length: 3, Data: []byte("xyz")}, // reserved frame type
+		{Type: FRAME_DATA, Length: 0},
+		{Type: FRAME_DATA, Length: 6, Data: []byte(" world")},
+	} {
+		f.Write(&buf)
+	}
+
+	data, err := io.ReadAll(NewBody(&readStream{r: &buf}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello world" {
+		t.Fatalf("got %q", data)
+	}
+}
+
+func TestBodyUnexpectedFrame(t *testing.T) {
+	var buf bytes.Buffer
+	f := Frame{Type: FRAME_SETTINGS, Length: 0}
+	f.Write(&buf)
+
+	str := &readStream{r: &buf}
+	body := NewBody(str)
+	if _, err := body.Read(make([]byte, 8)); err != ErrFrameUnexpected {
+		t.Fatalf("got %v, want ErrFrameUnexpected", err)
+	}
+	body.Close()
+	if !str.canceled {
+		t.Fatal("reading was not canceled")
+	}
+}
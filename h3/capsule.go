@@ -0,0 +1,155 @@
+package h3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand/v2"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// Capsule types
+const (
+	// https://www.ietf.org/archive/id/draft-ietf-webtrans-http3-07.html#section-5
+	CAPSULE_CLOSE_WEBTRANSPORT_SESSION = 0x2843
+
+	// https://www.ietf.org/archive/id/draft-ietf-webtrans-http3-07.html#section-4.6
+	CAPSULE_DRAIN_WEBTRANSPORT_SESSION = 0x78ae
+
+	// https://www.ietf.org/archive/id/draft-ietf-webtrans-http3-09.html#section-5.6
+	CAPSULE_WT_MAX_DATA             = 0x190b4d3d
+	CAPSULE_WT_MAX_STREAMS_BIDI     = 0x190b4d3f
+	CAPSULE_WT_MAX_STREAMS_UNI      = 0x190b4d40
+	CAPSULE_WT_DATA_BLOCKED         = 0x190b4d41
+	CAPSULE_WT_STREAMS_BLOCKED_BIDI = 0x190b4d43
+	CAPSULE_WT_STREAMS_BLOCKED_UNI  = 0x190b4d44
+)
+
+// MAX_CLOSE_MESSAGE_LEN is the maximum length of the error message of a
+// CLOSE_WEBTRANSPORT_SESSION capsule.
+const MAX_CLOSE_MESSAGE_LEN = 1024
+
+var ErrCapsuleMalformed = errors.New("malformed capsule")
+
+// Capsule is an HTTP capsule, sent in the data of the request stream.
+// https://www.rfc-editor.org/rfc/rfc9297.html#section-3.2
+type Capsule struct {
+	Type   uint64
+	Length uint64
+	Data   []byte
+}
+
+// Read reads a capsule from a reader and stores it in the capsule. The value of
+// a capsule of an unknown type is skipped and its Data is nil.
+func (c *Capsule) Read(r io.Reader) error {
+	qr := quicvarint.NewReader(r)
+	t, err := quicvarint.Read(qr)
+	if err != nil {
+		return err
+	}
+	l, err := quicvarint.Read(qr)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	c.Type = t
+	c.Length = l
+	c.Data = nil
+
+	switch t {
+	case CAPSULE_CLOSE_WEBTRANSPORT_SESSION:
+		if l < 4 || l > 4+MAX_CLOSE_MESSAGE_LEN {
+			return ErrCapsuleMalformed
+		}
+		c.Data = make([]byte, l)
+		_, err = io.ReadFull(r, c.Data)
+	case CAPSULE_DRAIN_WEBTRANSPORT_SESSION:
+		if l != 0 {
+			return ErrCapsuleMalformed
+		}
+	case CAPSULE_WT_MAX_DATA, CAPSULE_WT_MAX_STREAMS_BIDI,
+		CAPSULE_WT_MAX_STREAMS_UNI, CAPSULE_WT_DATA_BLOCKED,
+		CAPSULE_WT_STREAMS_BLOCKED_BIDI, CAPSULE_WT_STREAMS_BLOCKED_UNI:
+		// The value of the flow control capsules is a single varint
+		if l == 0 || l > 8 {
+			return ErrCapsuleMalformed
+		}
+		c.Data = make([]byte, l)
+		_, err = io.ReadFull(r, c.Data)
+	default:
+		// Unknown capsule types are skipped
+		_, err = io.CopyN(io.Discard, r, int64(l))
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Write writes a capsule to a writer.
+func (c *Capsule) Write(w io.Writer) (int, error) {
+	buf := &bytes.Buffer{}
+	buf.Write(quicvarint.Append(nil, c.Type))
+	buf.Write(quicvarint.Append(nil, c.Length))
+	buf.Write(c.Data)
+	return w.Write(buf.Bytes())
+}
+
+// NewCloseCapsule returns a CLOSE_WEBTRANSPORT_SESSION capsule with the given
+// application error code and error message. The message is truncated to
+// MAX_CLOSE_MESSAGE_LEN bytes.
+func NewCloseCapsule(code uint32, msg string) Capsule {
+	if len(msg) > MAX_CLOSE_MESSAGE_LEN {
+		msg = msg[:MAX_CLOSE_MESSAGE_LEN]
+	}
+	data := binary.BigEndian.AppendUint32(nil, code)
+	data = append(data, msg...)
+	return Capsule{
+		Type:   CAPSULE_CLOSE_WEBTRANSPORT_SESSION,
+		Length: uint64(len(data)),
+		Data:   data,
+	}
+}
+
+// NewGreaseCapsule returns an empty capsule of a reserved type, which the peer
+// ignores. Reserved capsule types have the form 0x29 * N + 0x17.
+// https://www.rfc-editor.org/rfc/rfc9297.html#section-5.4
+func NewGreaseCapsule() Capsule {
+	return Capsule{Type: 0x29*uint64(rand.IntN(1<<16)) + 0x17}
+}
+
+// NewDrainCapsule returns a DRAIN_WEBTRANSPORT_SESSION capsule.
+func NewDrainCapsule() Capsule {
+	return Capsule{Type: CAPSULE_DRAIN_WEBTRANSPORT_SESSION}
+}
+
+// NewVarintCapsule returns a capsule of the given type whose value is a single
+// varint, e.g. a WT_MAX_DATA capsule.
+func NewVarintCapsule(t, v uint64) Capsule {
+	data := quicvarint.Append(nil, v)
+	return Capsule{Type: t, Length: uint64(len(data)), Data: data}
+}
+
+// Varint returns the value of a capsule whose value is a single varint.
+func (c *Capsule) Varint() (uint64, error) {
+	r := bytes.NewReader(c.Data)
+	v, err := quicvarint.Read(r)
+	if err != nil || r.Len() != 0 {
+		return 0, ErrCapsuleMalformed
+	}
+	return v, nil
+}
+
+// CloseInfo returns the application error code and error message of a
+// CLOSE_WEBTRANSPORT_SESSION capsule.
+func (c *Capsule) CloseInfo() (code uint32, msg string, err error) {
+	if c.Type != CAPSULE_CLOSE_WEBTRANSPORT_SESSION || len(c.Data) < 4 {
+		return 0, "", ErrCapsuleMalformed
+	}
+	return binary.BigEndian.Uint32(c.Data), string(c.Data[4:]), nil
+}
@@ -0,0 +1,126 @@
+package h3
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+func TestCloseCapsule(t *testing.T) {
+	var buf bytes.Buffer
+	in := NewCloseCapsule(7, "bye")
+	if _, err := in.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var out Capsule
+	if err := out.Read(&buf); err != nil {
+		t.Fatal(err)
+	}
+	code, msg, err := out.CloseInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Type != CAPSULE_CLOSE_WEBTRANSPORT_SESSION || code != 7 || msg != "bye" {
+		t.Fatalf("got %+v, code %d, message %q", out, code, msg)
+	}
+}
+
+func TestCloseCapsuleMessageTruncated(t *testing.T) {
+	c := NewCloseCapsule(1, strings.Repeat("x", 2*MAX_CLOSE_MESSAGE_LEN))
+	_, msg, err := c.CloseInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg) != MAX_CLOSE_MESSAGE_LEN {
+		t.Fatalf("got a message of %d bytes, want %d", len(msg),
+			MAX_CLOSE_MESSAGE_LEN)
+	}
+}
+
+func TestVarintCapsule(t *testing.T) {
+	var buf bytes.Buffer
+	in := NewVarintCapsule(CAPSULE_WT_MAX_DATA, 1<<40)
+	in.Write(&buf)
+
+	var out Capsule
+	if err := out.Read(&buf); err != nil {
+		t.Fatal(err)
+	}
+	v, err := out.Varint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Type != CAPSULE_WT_MAX_DATA || v != 1<<40 {
+		t.Fatalf("got %+v with value %d", out, v)
+	}
+
+	// Trailing bytes after the varint
+	out.Data = append(out.Data, 0)
+	if _, err := out.Varint(); err != ErrCapsuleMalformed {
+		t.Fatalf("got %v, want ErrCapsuleMalformed", err)
+	}
+}
+
+func TestUnknownCapsuleSkipped(t *testing.T) {
+	var buf bytes.Buffer
+	grease := NewGreaseCapsule()
+	grease.Data = []byte("ignored")
+	grease.Length = uint64(len(grease.Data))
+	grease.Write(&buf)
+	drain := NewDrainCapsule()
+	drain.Write(&buf)
+
+	var out Capsule
+	if err := out.Read(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if (out.Type-0x17)%0x29 != 0 || out.Data != nil {
+		t.Fatalf("got %+v, want a skipped grease capsule", out)
+	}
+	if err := out.Read(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if out.Type != CAPSULE_DRAIN_WEBTRANSPORT_SESSION {
+		t.Fatalf("got type %#x after the skipped capsule", out.Type)
+	}
+}
+
+func TestCapsuleMalformed(t *testing.T) {
+	capsule := func(t, l uint64, data string) []byte {
+		b := quicvarint.Append(nil, t)
+		b = quicvarint.Append(b, l)
+		return append(b, data...)
+	}
+	for _, tt := range []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"close without code", capsule(CAPSULE_CLOSE_WEBTRANSPORT_SESSION, 2, "ab"),
+			ErrCapsuleMalformed},
+		{"close message too long", capsule(CAPSULE_CLOSE_WEBTRANSPORT_SESSION,
+			4+MAX_CLOSE_MESSAGE_LEN+1, ""), ErrCapsuleMalformed},
+		{"drain with a value", capsule(CAPSULE_DRAIN_WEBTRANSPORT_SESSION, 1, "x"),
+			ErrCapsuleMalformed},
+		{"empty limit", capsule(CAPSULE_WT_MAX_STREAMS_BIDI, 0, ""),
+			ErrCapsuleMalformed},
+		{"limit too long", capsule(CAPSULE_WT_MAX_DATA, 9, "123456789"),
+			ErrCapsuleMalformed},
+		{"truncated value", capsule(CAPSULE_CLOSE_WEBTRANSPORT_SESSION, 8, "abcd"),
+			io.ErrUnexpectedEOF},
+		{"truncated unknown capsule", capsule(0x17, 8, "abcd"),
+			io.ErrUnexpectedEOF},
+		{"missing length", quicvarint.Append(nil, CAPSULE_WT_MAX_DATA),
+			io.ErrUnexpectedEOF},
+		{"empty", nil, io.EOF},
+	} {
+		var c Capsule
+		if err := c.Read(bytes.NewReader(tt.data)); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package h3
+
+// HTTP/3 error codes
+// https://www.rfc-editor.org/rfc/rfc9114.html#section-8.1
+const (
+	H3_NO_ERROR               = 0x100
+	H3_GENERAL_PROTOCOL_ERROR = 0x101
+	H3_INTERNAL_ERROR         = 0x102
+	H3_STREAM_CREATION_ERROR  = 0x103
+	H3_CLOSED_CRITICAL_STREAM = 0x104
+	H3_FRAME_UNEXPECTED       = 0x105
+	H3_FRAME_ERROR            = 0x106
+	H3_EXCESSIVE_LOAD         = 0x107
+	H3_ID_ERROR               = 0x108
+	H3_SETTINGS_ERROR         = 0x109
+	H3_MISSING_SETTINGS       = 0x10a
+	H3_REQUEST_REJECTED       = 0x10b
+	H3_REQUEST_CANCELLED      = 0x10c
+	H3_REQUEST_INCOMPLETE     = 0x10d
+	H3_MESSAGE_ERROR          = 0x10e
+	H3_CONNECT_ERROR          = 0x10f
+	H3_VERSION_FALLBACK       = 0x110
+)
+
+// WebTransport error codes
+// https://www.ietf.org/archive/id/draft-ietf-webtrans-http3-07.html#section-9.5
+const (
+	WEBTRANSPORT_BUFFERED_STREAM_REJECTED = 0x3994bd84
+	WEBTRANSPORT_SESSION_GONE             = 0x170d7b68
+)
+
+// Range of HTTP/3 error codes carrying WebTransport application error codes
+// https://www.ietf.org/archive/id/draft-ietf-webtrans-http3-07.html#section-4.3
+const (
+	WEBTRANSPORT_APPLICATION_ERROR_FIRST = 0x52e4a40fa8db
+	WEBTRANSPORT_APPLICATION_ERROR_LAST  = 0x52e5ac983162
+)
+
+// WebTransport flow control error code
+// https://www.ietf.org/archive/id/draft-ietf-webtrans-http3-09.html#section-9.5
+const (
+	WT_FLOW_CONTROL_ERROR = 0x045d4487
+)
@@ -2,6 +2,7 @@ package h3
 
 import (
 	"bytes"
+	"errors"
 	"io"
 
 	"github.com/quic-go/quic-go/quicvarint"
@@ -19,6 +20,10 @@ const (
 	FRAME_WEBTRANSPORT_STREAM = 0x41
 )
 
+// ErrFrameTooLarge is returned by Frame.ReadMax for a frame whose payload is
+// longer than the allowed maximum.
+var ErrFrameTooLarge = errors.New("frame too large")
+
 // HTTP/3 frame
 type Frame struct {
 	Type      uint64
@@ -27,8 +32,17 @@ type Frame struct {
 	Data      []byte
 }
 
-// Read reads an HTTP/3 frame from a reader and stores it in the frame.
+// Read reads an HTTP/3 frame from a reader and stores it in the frame. The
+// length of the frame payload is not limited, so frames received from a peer
+// should be read with ReadMax.
 func (f *Frame) Read(r io.Reader) error {
+	return f.ReadMax(r, quicvarint.Max)
+}
+
+// ReadMax reads an HTTP/3 frame from a reader and stores it in the frame. It
+// returns ErrFrameTooLarge without reading the payload if the payload is
+// longer than maxLength bytes.
+func (f *Frame) ReadMax(r io.Reader, maxLength uint64) error {
 	qr := quicvarint.NewReader(r)
 	t, err := quicvarint.Read(qr)
 	if err != nil {
@@ -52,8 +66,11 @@ func (f *Frame) Read(r io.Reader) error {
 	default:
 		// For most frame types, l is the data length
 		f.Length = l
+		if l > maxLength {
+			return ErrFrameTooLarge
+		}
 		f.Data = make([]byte, l)
-		_, err := r.Read(f.Data)
+		_, err := io.ReadFull(r, f.Data)
 		return err
 	}
 }
@@ -0,0 +1,67 @@
+package h3
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+func TestFrameReadWrite(t *testing.T) {
+	var buf bytes.Buffer
+	in := Frame{Type: FRAME_HEADERS, Length: 3, Data: []byte("abc")}
+	if _, err := in.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var out Frame
+	if err := out.Read(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if out.Type != FRAME_HEADERS || out.Length != 3 || string(out.Data) != "abc" {
+		t.Fatalf("got %+v", out)
+	}
+}
+
+func TestFrameReadWebTransportStream(t *testing.T) {
+	var buf bytes.Buffer
+	in := Frame{Type: FRAME_WEBTRANSPORT_STREAM, SessionID: 8}
+	if _, err := in.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("stream data")
+
+	var out Frame
+	if err := out.ReadMax(&buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	if out.Type != FRAME_WEBTRANSPORT_STREAM || out.SessionID != 8 {
+		t.Fatalf("got %+v", out)
+	}
+	if buf.String() != "stream data" {
+		t.Fatalf("stream data consumed: %q", buf.String())
+	}
+}
+
+func TestFrameReadMax(t *testing.T) {
+	// A frame announcing a huge payload is rejected before the payload is
+	// allocated
+	b := quicvarint.Append(nil, FRAME_SETTINGS)
+	b = quicvarint.Append(b, 1<<61)
+
+	var f Frame
+	if err := f.ReadMax(bytes.NewReader(b), 8<<10); err != ErrFrameTooLarge {
+		t.Fatalf("got %v, want ErrFrameTooLarge", err)
+	}
+
+	// A payload of the maximum length is read
+	var buf bytes.Buffer
+	in := Frame{Type: FRAME_HEADERS, Length: 4, Data: []byte("abcd")}
+	in.Write(&buf)
+	if err := f.ReadMax(&buf, 4); err != nil {
+		t.Fatal(err)
+	}
+	if string(f.Data) != "abcd" {
+		t.Fatalf("got %q", f.Data)
+	}
+}
@@ -0,0 +1,40 @@
+package h3
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/quic-go/qpack"
+)
+
+// WriteRequestHeaders writes the HEADERS frame of an HTTP/3 request to a
+// writer. For an extended CONNECT request, the protocol is sent in the
+// ":protocol" pseudo-header; it is empty for any other request.
+func WriteRequestHeaders(w io.Writer, req *http.Request, protocol string) error {
+	var headers bytes.Buffer
+	enc := qpack.NewEncoder(&headers)
+
+	// The request pseudo-headers are always sent first
+	path := req.URL.RequestURI()
+	enc.WriteField(qpack.HeaderField{Name: ":method", Value: req.Method})
+	if len(protocol) > 0 {
+		enc.WriteField(qpack.HeaderField{Name: ":protocol", Value: protocol})
+	}
+	enc.WriteField(qpack.HeaderField{Name: ":scheme", Value: req.URL.Scheme})
+	enc.WriteField(qpack.HeaderField{Name: ":authority", Value: req.URL.Host})
+	enc.WriteField(qpack.HeaderField{Name: ":path", Value: path})
+
+	// Then the other headers
+	for k, v := range req.Header {
+		for index := range v {
+			enc.WriteField(qpack.HeaderField{Name: strings.ToLower(k), Value: v[index]})
+		}
+	}
+
+	// Create a frame with the headers and write it
+	headersFrame := Frame{Type: FRAME_HEADERS, Length: uint64(headers.Len()), Data: headers.Bytes()}
+	_, err := headersFrame.Write(w)
+	return err
+}
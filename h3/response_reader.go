@@ -0,0 +1,54 @@
+package h3
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/quic-go/qpack"
+)
+
+var ErrStatusInvalid = errors.New(":status must be a valid status code")
+
+// ResponseFromHeaders returns a new http.Response from the given headers.
+// It takes into account the HTTP/3 specific ":status" pseudo-header and sets
+// the status, protocol version, headers and content length of the response.
+// If an error occurs, it returns an error.
+func ResponseFromHeaders(headers []qpack.HeaderField) (*http.Response, error) {
+	var status string
+	httpHeaders := http.Header{}
+
+	// Parse the headers
+	for _, h := range headers {
+		switch {
+		case h.Name == ":status":
+			status = h.Value
+		case !h.IsPseudo():
+			httpHeaders.Add(h.Name, h.Value)
+		}
+	}
+
+	statusCode, err := strconv.Atoi(status)
+	if err != nil || statusCode < 100 || statusCode > 999 {
+		return nil, ErrStatusInvalid
+	}
+
+	// Set the content length
+	contentLength := int64(-1)
+	if cl := httpHeaders.Get("Content-Length"); len(cl) > 0 {
+		contentLength, err = strconv.ParseInt(cl, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &http.Response{
+		Status:        status + " " + http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/3.0",
+		ProtoMajor:    3,
+		ProtoMinor:    0,
+		Header:        httpHeaders,
+		ContentLength: contentLength,
+	}, nil
+}
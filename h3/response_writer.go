@@ -9,6 +9,7 @@ import (
 
 	"github.com/quic-go/qpack"
 	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
 )
 
 // DataStreamer lets the caller take over the stream. After a call to DataStream
@@ -114,8 +115,11 @@ func (w *ResponseWriter) Write(p []byte) (int, error) {
 	// Create a frame with the data
 	dataFrame := Frame{Type: FRAME_DATA, Length: uint64(len(p)), Data: p}
 
-	// Write the frame to the stream
-	return dataFrame.Write(w.bufferedStream)
+	// Write the frame to the stream and report the payload bytes written, as
+	// io.Writer requires
+	n, err := dataFrame.Write(w.bufferedStream)
+	n -= quicvarint.Len(FRAME_DATA) + quicvarint.Len(dataFrame.Length)
+	return max(n, 0), err
 }
 
 // Flush implements http.Flusher.
@@ -142,6 +146,22 @@ func (w *ResponseWriter) DataStream() quic.Stream {
 	return w.stream
 }
 
+// Close finishes the response: it writes the response header if it was not
+// written yet, flushes the buffered data and closes the write direction of the
+// stream. It does nothing if the stream was taken over with DataStream.
+func (w *ResponseWriter) Close() error {
+	if w.dataStreamUsed {
+		return nil
+	}
+	if !w.headerWritten {
+		w.WriteHeader(http.StatusOK)
+	}
+	if err := w.bufferedStream.Flush(); err != nil {
+		return err
+	}
+	return w.stream.Close()
+}
+
 // copied from http2/http2.go
 // bodyAllowedForStatus reports whether a given response status code
 // permits a body. See RFC 2616, section 4.4.
@@ -0,0 +1,36 @@
+package h3
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+)
+
+// writeStream is a quic.Stream writing to a buffer. Only Write may be called.
+type writeStream struct {
+	quic.Stream
+	buf bytes.Buffer
+}
+
+func (s *writeStream) Write(p []byte) (int, error) { return s.buf.Write(p) }
+
+func TestResponseWriterWrite(t *testing.T) {
+	str := &writeStream{}
+	w := NewResponseWriter(str)
+
+	// The payload length is reported, not the length of the DATA frame
+	if n, err := w.Write([]byte("hello")); n != 5 || err != nil {
+		t.Fatalf("got %d, %v, want 5, nil", n, err)
+	}
+	w.Flush()
+
+	var f Frame
+	if err := f.Read(&str.buf); err != nil || f.Type != FRAME_HEADERS {
+		t.Fatalf("got %+v, %v, want a HEADERS frame", f, err)
+	}
+	if err := f.Read(&str.buf); err != nil || f.Type != FRAME_DATA ||
+		string(f.Data) != "hello" {
+		t.Fatalf("got %+v, %v, want a DATA frame", f, err)
+	}
+}
@@ -16,22 +16,64 @@ const (
 	SETTINGS_QPACK_MAX_TABLE_CAPACITY = SettingID(0x1)
 	SETTINGS_QPACK_BLOCKED_STREAMS    = SettingID(0x7)
 
+	// https://www.rfc-editor.org/rfc/rfc9220.html#section-5
+	SETTINGS_ENABLE_CONNECT_PROTOCOL = SettingID(0x8)
+
+	// https://www.rfc-editor.org/rfc/rfc9297.html#section-5.1
+	SETTINGS_H3_DATAGRAM = SettingID(0x33)
+
 	// https://datatracker.ietf.org/doc/html/draft-ietf-masque-h3-datagram-05#section-9.1
 	H3_DATAGRAM_05 = SettingID(0xffd277)
 
 	// https://www.ietf.org/archive/id/draft-ietf-webtrans-http3-02.html#section-8.2
 	ENABLE_WEBTRANSPORT = SettingID(0x2b603742)
+
+	// https://www.ietf.org/archive/id/draft-ietf-webtrans-http3-07.html#section-8.2
+	WEBTRANSPORT_MAX_SESSIONS = SettingID(0xc671706a)
+
+	// https://www.ietf.org/archive/id/draft-ietf-webtrans-http3-09.html#section-9.2
+	SETTINGS_WT_INITIAL_MAX_DATA         = SettingID(0x2b61)
+	SETTINGS_WT_INITIAL_MAX_STREAMS_UNI  = SettingID(0x2b64)
+	SETTINGS_WT_INITIAL_MAX_STREAMS_BIDI = SettingID(0x2b65)
 )
 
 type SettingID uint64
 
+// isReservedHTTP2 reports whether the setting ID is reserved because it is an
+// HTTP/2 setting without an HTTP/3 equivalent.
+// https://www.rfc-editor.org/rfc/rfc9114.html#section-7.2.4.1
+func (id SettingID) isReservedHTTP2() bool {
+	switch id {
+	case 0x0, 0x2, 0x3, 0x4, 0x5:
+		return true
+	}
+	return false
+}
+
+// isBoolean reports whether the setting only allows the values 0 and 1.
+func (id SettingID) isBoolean() bool {
+	switch id {
+	case SETTINGS_ENABLE_CONNECT_PROTOCOL, SETTINGS_H3_DATAGRAM, H3_DATAGRAM_05,
+		ENABLE_WEBTRANSPORT:
+		return true
+	}
+	return false
+}
+
+// MAX_SETTINGS_FRAME_LEN is the maximum length of a SETTINGS frame payload
+// accepted from the peer.
+const MAX_SETTINGS_FRAME_LEN = 8 << 10
+
 type SettingsMap map[SettingID]uint64
 
 // FromFrame reads a Frame and stores it in the SettingsMap.
 //
-// It returns an error if the frame size is too large or if there are duplicate settings.
+// It returns an error if the frame size is too large, if there are duplicate
+// settings, if a setting reserved for HTTP/2 is received or if a boolean
+// setting has a value other than 0 or 1. Any such error is a connection error
+// of type H3_SETTINGS_ERROR.
 func (s *SettingsMap) FromFrame(f Frame) error {
-	if f.Length > 8*(1<<10) {
+	if f.Length > MAX_SETTINGS_FRAME_LEN {
 		return fmt.Errorf("unexpected size for SETTINGS frame: %d", f.Length)
 	}
 
@@ -49,6 +91,12 @@ func (s *SettingsMap) FromFrame(f Frame) error {
 		if _, ok := (*s)[SettingID(id)]; ok {
 			return fmt.Errorf("duplicate setting: %d", id)
 		}
+		if SettingID(id).isReservedHTTP2() {
+			return fmt.Errorf("reserved HTTP/2 setting: %d", id)
+		}
+		if SettingID(id).isBoolean() && val > 1 {
+			return fmt.Errorf("invalid value %d for setting %s", val, SettingID(id))
+		}
 		(*s)[SettingID(id)] = val
 	}
 	return nil
@@ -88,12 +136,30 @@ func (id SettingID) String() string {
 	case 0x07:
 		// QPACK_BLOCKED_STREAMS (draft-ietf-quic-qpack-21)
 		return "QPACK_BLOCKED_STREAMS"
+	case 0x08:
+		// ENABLE_CONNECT_PROTOCOL (RFC 9220)
+		return "ENABLE_CONNECT_PROTOCOL"
+	case 0x33:
+		// H3_DATAGRAM (RFC 9297)
+		return "H3_DATAGRAM"
 	case 0x2b603742:
 		// ENABLE_WEBTRANSPORT (draft-ietf-webtrans-http3-02)
 		return "ENABLE_WEBTRANSPORT"
+	case 0xc671706a:
+		// WEBTRANSPORT_MAX_SESSIONS (draft-ietf-webtrans-http3-07)
+		return "WEBTRANSPORT_MAX_SESSIONS"
 	case 0xffd277:
 		// H3_DATAGRAM_05 (draft-ietf-masque-h3-datagram-05)
 		return "H3_DATAGRAM_05"
+	case 0x2b61:
+		// WT_INITIAL_MAX_DATA (draft-ietf-webtrans-http3-09)
+		return "WT_INITIAL_MAX_DATA"
+	case 0x2b64:
+		// WT_INITIAL_MAX_STREAMS_UNI (draft-ietf-webtrans-http3-09)
+		return "WT_INITIAL_MAX_STREAMS_UNI"
+	case 0x2b65:
+		// WT_INITIAL_MAX_STREAMS_BIDI (draft-ietf-webtrans-http3-09)
+		return "WT_INITIAL_MAX_STREAMS_BIDI"
 	default:
 		return fmt.Sprintf("%#x", uint64(id))
 	}
@@ -0,0 +1,65 @@
+package h3
+
+import (
+	"testing"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// settingsFrame returns a SETTINGS frame with the setting IDs and values.
+func settingsFrame(pairs ...uint64) Frame {
+	var data []byte
+	for _, v := range pairs {
+		data = quicvarint.Append(data, v)
+	}
+	return Frame{Type: FRAME_SETTINGS, Length: uint64(len(data)), Data: data}
+}
+
+func TestSettingsRoundTrip(t *testing.T) {
+	in := SettingsMap{
+		ENABLE_WEBTRANSPORT:       1,
+		WEBTRANSPORT_MAX_SESSIONS: 16,
+		0x1f*3 + 0x21:             7, // reserved setting
+	}
+	out := SettingsMap{}
+	if err := out.FromFrame(in.ToFrame()); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(in) {
+		t.Fatalf("got %v, want %v", out, in)
+	}
+	for id, v := range in {
+		if out[id] != v {
+			t.Fatalf("got %v, want %v", out, in)
+		}
+	}
+}
+
+func TestSettingsInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		frame Frame
+	}{
+		{"duplicate", settingsFrame(uint64(SETTINGS_H3_DATAGRAM), 1,
+			uint64(SETTINGS_H3_DATAGRAM), 1)},
+		{"HTTP/2 setting", settingsFrame(0x2, 0)},
+		{"boolean value", settingsFrame(uint64(ENABLE_WEBTRANSPORT), 2)},
+		{"missing value", settingsFrame(uint64(SETTINGS_H3_DATAGRAM))},
+		{"too large", Frame{Type: FRAME_SETTINGS,
+			Length: MAX_SETTINGS_FRAME_LEN + 1}},
+	} {
+		s := SettingsMap{}
+		if err := s.FromFrame(tt.frame); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
+
+func TestSettingIDString(t *testing.T) {
+	if s := WEBTRANSPORT_MAX_SESSIONS.String(); s != "WEBTRANSPORT_MAX_SESSIONS" {
+		t.Fatalf("got %q", s)
+	}
+	if s := SettingID(0x21).String(); s != "0x21" {
+		t.Fatalf("got %q", s)
+	}
+}
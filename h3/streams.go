@@ -2,6 +2,7 @@ package h3
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 
@@ -17,6 +18,11 @@ const (
 	STREAM_WEBTRANSPORT_UNI_STREAM = 0x54
 )
 
+// ErrUnknownStreamType is returned by StreamHeader.Read for stream types which
+// are not known to this package, including reserved (GREASE) stream types.
+// The Type field of the StreamHeader is set to the received type.
+var ErrUnknownStreamType = errors.New("unknown stream type")
+
 // HTTP/3 stream header
 type StreamHeader struct {
 	Type uint64
@@ -49,7 +55,7 @@ func (s *StreamHeader) Read(r io.Reader) error {
 		return nil
 	default:
 		// skip over unknown streams
-		return fmt.Errorf("unknown stream type")
+		return ErrUnknownStreamType
 	}
 }
 
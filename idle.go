@@ -0,0 +1,134 @@
+// Copyright 2025 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Idle timeout module of webtransport package.
+
+package webtransport
+
+import (
+	"time"
+
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// idleTimeoutMessage is the error message of the CLOSE_WEBTRANSPORT_SESSION
+// capsule sent when a session is closed after its idle timeout.
+const idleTimeoutMessage = "idle timeout"
+
+// touch records activity on the session: a stream was opened or accepted,
+// stream data or a datagram was sent or received, or a capsule was received.
+func (s *Session) touch() {
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+// idleTime returns the time since the last activity on the session.
+func (s *Session) idleTime() time.Duration {
+	return time.Duration(time.Now().UnixNano() - s.lastActivity.Load())
+}
+
+// SetIdleTimeout sets the idle timeout of the session. The session is closed
+// with the CloseCauseIdleTimeout cause if there is no stream or datagram
+// activity for the given duration. A zero duration disables the idle timeout.
+//
+// Keepalive capsules sent by the session (see SetKeepAlivePeriod) are not
+// activity, while any capsule received from the peer is.
+func (s *Session) SetIdleTimeout(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idleTimeout = d
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleTimer = nil
+	}
+	if d > 0 && s.err == nil {
+		s.idleTimer = time.AfterFunc(d, s.checkIdle)
+	}
+}
+
+// checkIdle closes the session if it has been idle for the idle timeout, or
+// restarts the idle timer otherwise. A session which was not accepted yet is
+// not closed.
+func (s *Session) checkIdle() {
+	s.writeMu.Lock()
+	accepted := s.accepted
+	s.writeMu.Unlock()
+
+	s.mu.Lock()
+	if s.idleTimer == nil || s.idleTimeout <= 0 {
+		s.mu.Unlock()
+		return
+	}
+	idle := s.idleTime()
+	if idle < s.idleTimeout || !accepted {
+		next := s.idleTimeout
+		if idle < s.idleTimeout {
+			next -= idle
+		}
+		s.idleTimer.Reset(next)
+		s.mu.Unlock()
+		return
+	}
+	s.idleTimer = nil
+	s.mu.Unlock()
+
+	s.closeSession(&SessionError{
+		Message: idleTimeoutMessage,
+		Cause:   CloseCauseIdleTimeout,
+	})
+}
+
+// SetKeepAlivePeriod sets the keepalive period of the session. If there is no
+// stream or datagram activity on the session for the given duration, a
+// capsule of a reserved type is sent on the request stream, which keeps the
+// QUIC connection and the NAT bindings on its path alive, and counts as
+// activity for the idle timeout of the peer. A zero duration disables the
+// keepalive.
+func (s *Session) SetKeepAlivePeriod(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keepAlivePeriod = d
+	if s.keepAliveTimer != nil {
+		s.keepAliveTimer.Stop()
+		s.keepAliveTimer = nil
+	}
+	if d > 0 && s.err == nil {
+		s.keepAliveTimer = time.AfterFunc(d, s.keepAlive)
+	}
+}
+
+// keepAlive sends a keepalive capsule if the session has been idle for the
+// keepalive period and restarts the keepalive timer.
+func (s *Session) keepAlive() {
+	s.mu.Lock()
+	if s.keepAliveTimer == nil || s.keepAlivePeriod <= 0 {
+		s.mu.Unlock()
+		return
+	}
+	next := s.keepAlivePeriod
+	idle := s.idleTime()
+	send := idle >= s.keepAlivePeriod
+	if !send {
+		next -= idle
+	}
+	s.keepAliveTimer.Reset(next)
+	s.mu.Unlock()
+
+	// The keepalive itself is not activity
+	if send {
+		s.writeCapsule(h3.NewGreaseCapsule())
+	}
+}
+
+// stopTimers stops the idle and keepalive timers of the session. It must be
+// called with the session mutex held.
+func (s *Session) stopTimers() {
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleTimer = nil
+	}
+	if s.keepAliveTimer != nil {
+		s.keepAliveTimer.Stop()
+		s.keepAliveTimer = nil
+	}
+}
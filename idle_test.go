@@ -0,0 +1,78 @@
+package webtransport
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionIdleTimeout(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{
+		SessionIdleTimeout: 50 * time.Millisecond,
+	})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	e := sessionError(t, server)
+	if e.Cause != CloseCauseIdleTimeout || e.Remote {
+		t.Fatalf("got %+v", e)
+	}
+	// The peer is told why in the close capsule
+	e = sessionError(t, client)
+	if e.Cause != CloseCauseCapsule || e.Message != idleTimeoutMessage || !e.Remote {
+		t.Fatalf("got %+v", e)
+	}
+}
+
+func TestSessionIdleActivity(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	url, sessions := startSessionServer(t, &Server{})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+	server.SetIdleTimeout(timeout)
+
+	// Datagrams received by the server are activity
+	for range 10 {
+		if err := client.SendDatagram([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(timeout / 4)
+	}
+	if err := server.Err(); err != nil {
+		t.Fatalf("the active session ended with %v", err)
+	}
+
+	// Without activity the session is closed
+	if e := sessionError(t, server); e.Cause != CloseCauseIdleTimeout {
+		t.Fatalf("got %+v", e)
+	}
+}
+
+func TestSessionIdleTimeoutDisabled(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{
+		SessionIdleTimeout: 20 * time.Millisecond,
+	})
+	_, server := dialSession(t, nil, url+"/wt", sessions)
+	server.SetIdleTimeout(0)
+
+	time.Sleep(100 * time.Millisecond)
+	if err := server.Err(); err != nil {
+		t.Fatalf("the session ended with %v", err)
+	}
+}
+
+func TestSessionKeepAlive(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	url, sessions := startSessionServer(t, &Server{})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+	server.SetIdleTimeout(timeout)
+	client.SetKeepAlivePeriod(timeout / 4)
+
+	// The keepalive capsules of the client keep the server side open
+	time.Sleep(3 * timeout)
+	if err := server.Err(); err != nil {
+		t.Fatalf("the session ended with %v", err)
+	}
+
+	client.SetKeepAlivePeriod(0)
+	if e := sessionError(t, server); e.Cause != CloseCauseIdleTimeout {
+		t.Fatalf("got %+v", e)
+	}
+}
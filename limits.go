@@ -0,0 +1,202 @@
+// Copyright 2025 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Admission control module of webtransport package.
+
+package webtransport
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// DefaultRetryAfter is the default delay suggested to clients in the
+// Retry-After header of a session rejected by an admission limit.
+const DefaultRetryAfter = 5 * time.Second
+
+// overLimitTimeout is how long a connection over Server.MaxConnections is
+// kept open, so that the responses rejecting its requests reach the client,
+// before it is closed with the H3_EXCESSIVE_LOAD error code.
+const overLimitTimeout = time.Second
+
+// Default prefix lengths used to group client addresses for
+// Server.MaxSessionsPerPrefix.
+const (
+	DefaultIPv4PrefixLen = 24
+	DefaultIPv6PrefixLen = 64
+)
+
+// AdmissionStats contains the admission control counters of a Server.
+type AdmissionStats struct {
+	// Connections is the number of admitted QUIC connections
+	Connections int
+	// Sessions is the number of admitted WebTransport sessions
+	Sessions int
+
+	// RejectedConnections counts sessions and ordinary HTTP/3 requests
+	// rejected because their connection exceeded MaxConnections
+	RejectedConnections uint64
+	// RejectedSessions counts sessions rejected by MaxSessions
+	RejectedSessions uint64
+	// RejectedPerIP counts sessions rejected by MaxSessionsPerIP
+	RejectedPerIP uint64
+	// RejectedPerPrefix counts sessions rejected by MaxSessionsPerPrefix
+	RejectedPerPrefix uint64
+}
+
+// admission holds the state of the Server admission control. It is protected
+// by the Server mutex.
+type admission struct {
+	stats     AdmissionStats
+	perIP     map[netip.Addr]int
+	perPrefix map[netip.Prefix]int
+}
+
+// AdmissionStats returns the current admission control counters.
+func (s *Server) AdmissionStats() AdmissionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.admission.stats
+}
+
+// admitConn admits a new connection. It returns false if the server already
+// has MaxConnections connections; all requests on such a connection are
+// rejected, and it is closed after overLimitTimeout.
+func (s *Server) admitConn() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.MaxConnections > 0 && s.admission.stats.Connections >= s.MaxConnections {
+		return false
+	}
+	s.admission.stats.Connections++
+	return true
+}
+
+// closeOverLimit closes the connection c, which exceeds MaxConnections, after
+// overLimitTimeout. The returned function stops the timer.
+func (s *Server) closeOverLimit(c *conn) (stop func() bool) {
+	t := time.AfterFunc(overLimitTimeout, func() {
+		c.CloseWithError(h3.H3_EXCESSIVE_LOAD, "too many connections")
+	})
+	return t.Stop
+}
+
+// rejectOverLimit rejects an ordinary HTTP/3 request on a connection which
+// exceeds MaxConnections with 503 Service Unavailable.
+func (s *Server) rejectOverLimit(requestStream quic.Stream) {
+	s.mu.Lock()
+	s.admission.stats.RejectedConnections++
+	s.mu.Unlock()
+
+	rw := h3.NewResponseWriter(requestStream)
+	rw.Header().Set("Retry-After", s.retryAfter())
+	rw.WriteHeader(http.StatusServiceUnavailable)
+	rw.Close()
+	requestStream.CancelRead(h3.H3_NO_ERROR)
+}
+
+// releaseConn releases an admitted connection.
+func (s *Server) releaseConn() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.admission.stats.Connections--
+}
+
+// admitSession admits a new WebTransport session on the connection c. It
+// returns a function releasing the admitted session, or the HTTP status code
+// to reject the session with: 503 if a server wide limit is exceeded and 429
+// if a limit of the client address is exceeded.
+func (s *Server) admitSession(c *conn) (release func(), status int) {
+	ip := remoteIP(c.RemoteAddr())
+	var prefix netip.Prefix
+	if ip.IsValid() {
+		bits := s.IPv6PrefixLen
+		if bits == 0 {
+			bits = DefaultIPv6PrefixLen
+		}
+		if ip.Is4() {
+			bits = s.IPv4PrefixLen
+			if bits == 0 {
+				bits = DefaultIPv4PrefixLen
+			}
+		}
+		prefix, _ = ip.Prefix(bits)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := &s.admission
+	switch {
+	case c.overLimit:
+		a.stats.RejectedConnections++
+		return nil, http.StatusServiceUnavailable
+	case s.MaxSessions > 0 && a.stats.Sessions >= s.MaxSessions:
+		a.stats.RejectedSessions++
+		return nil, http.StatusServiceUnavailable
+	case s.MaxSessionsPerIP > 0 && ip.IsValid() &&
+		a.perIP[ip] >= s.MaxSessionsPerIP:
+		a.stats.RejectedPerIP++
+		return nil, http.StatusTooManyRequests
+	case s.MaxSessionsPerPrefix > 0 && prefix.IsValid() &&
+		a.perPrefix[prefix] >= s.MaxSessionsPerPrefix:
+		a.stats.RejectedPerPrefix++
+		return nil, http.StatusTooManyRequests
+	}
+
+	// Count the session
+	if a.perIP == nil {
+		a.perIP = make(map[netip.Addr]int)
+		a.perPrefix = make(map[netip.Prefix]int)
+	}
+	a.stats.Sessions++
+	if ip.IsValid() {
+		a.perIP[ip]++
+		a.perPrefix[prefix]++
+	}
+
+	release = func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		a.stats.Sessions--
+		if !ip.IsValid() {
+			return
+		}
+		if a.perIP[ip]--; a.perIP[ip] == 0 {
+			delete(a.perIP, ip)
+		}
+		if a.perPrefix[prefix]--; a.perPrefix[prefix] == 0 {
+			delete(a.perPrefix, prefix)
+		}
+	}
+	return release, 0
+}
+
+// retryAfter returns the value of the Retry-After header in seconds.
+func (s *Server) retryAfter() string {
+	d := s.RetryAfter
+	if d <= 0 {
+		d = DefaultRetryAfter
+	}
+	return strconv.Itoa(int((d + time.Second - 1) / time.Second))
+}
+
+// remoteIP returns the IP address of a remote UDP address, or the zero Addr if
+// it has none.
+func remoteIP(addr net.Addr) netip.Addr {
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		return udpAddr.AddrPort().Addr().Unmap()
+	}
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addrPort.Addr().Unmap()
+}
@@ -0,0 +1,132 @@
+package webtransport
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// dialRejected dials a session which must be rejected with the status and
+// returns the response.
+func dialRejected(t *testing.T, url string, status int) *http.Response {
+	t.Helper()
+	resp, session, err := testDialer().Dial(testContext(t), url+"/wt", nil)
+	if session != nil {
+		session.CloseSession()
+		t.Fatal("the session was established")
+	}
+	if err == nil {
+		t.Fatal("no error for a rejected session")
+	}
+	if resp == nil || resp.StatusCode != status {
+		t.Fatalf("got response %v, want %d", resp, status)
+	}
+	return resp
+}
+
+func TestAdmissionMaxSessions(t *testing.T) {
+	s := &Server{MaxSessions: 1, RetryAfter: 1500 * time.Millisecond}
+	url, sessions := startSessionServer(t, s)
+	client, _ := dialSession(t, nil, url+"/wt", sessions)
+
+	resp := dialRejected(t, url, http.StatusServiceUnavailable)
+	if v := resp.Header.Get("Retry-After"); v != "2" {
+		t.Fatalf("got Retry-After %q, want 2", v)
+	}
+	if stats := s.AdmissionStats(); stats.Sessions != 1 || stats.RejectedSessions != 1 {
+		t.Fatalf("got %+v", stats)
+	}
+
+	// The ended session is released, so a new one is admitted
+	client.CloseSession()
+	waitFor(t, "the session to be released", func() bool {
+		return s.AdmissionStats().Sessions == 0
+	})
+	dialSession(t, nil, url+"/wt", sessions)
+}
+
+func TestAdmissionMaxConnections(t *testing.T) {
+	s := &Server{MaxConnections: 1}
+	url, sessions := startSessionServer(t, s)
+	dialSession(t, nil, url+"/wt", sessions)
+
+	// Every Dial uses a new connection, which is over the limit
+	resp := dialRejected(t, url, http.StatusServiceUnavailable)
+	if resp.Header.Get("Retry-After") == "" {
+		t.Fatal("no Retry-After header")
+	}
+	if stats := s.AdmissionStats(); stats.Connections != 1 || stats.RejectedConnections != 1 {
+		t.Fatalf("got %+v", stats)
+	}
+
+	// Ordinary requests are rejected too
+	resp, err := httpClient(t).Get(url + "/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable ||
+		resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("got status %d with headers %v", resp.StatusCode, resp.Header)
+	}
+
+	// A connection over the limit is closed even if it sends no request
+	qconn := dialQUIC(t, url)
+	if code := connectionError(t, qconn); code != h3.H3_EXCESSIVE_LOAD {
+		t.Fatalf("got error code %#x, want H3_EXCESSIVE_LOAD", code)
+	}
+}
+
+func TestAdmissionPerClient(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		server   *Server
+		rejected func(AdmissionStats) uint64
+	}{
+		{"per IP", &Server{MaxSessionsPerIP: 1}, func(s AdmissionStats) uint64 {
+			return s.RejectedPerIP
+		}},
+		{"per prefix", &Server{MaxSessionsPerPrefix: 1}, func(s AdmissionStats) uint64 {
+			return s.RejectedPerPrefix
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			url, sessions := startSessionServer(t, tt.server)
+			dialSession(t, nil, url+"/wt", sessions)
+			dialRejected(t, url, http.StatusTooManyRequests)
+			if n := tt.rejected(tt.server.AdmissionStats()); n != 1 {
+				t.Fatalf("%d sessions rejected, want 1", n)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, tt := range []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "5"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+	} {
+		s := &Server{RetryAfter: tt.d}
+		if got := s.retryAfter(); got != tt.want {
+			t.Errorf("%v: got %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteIP(t *testing.T) {
+	mapped := &net.UDPAddr{IP: net.ParseIP("::ffff:10.0.0.1"), Port: 1}
+	if ip := remoteIP(mapped); ip != netip.MustParseAddr("10.0.0.1") {
+		t.Fatalf("got %v, want 10.0.0.1", ip)
+	}
+	if ip := remoteIP(&net.UnixAddr{Name: "sock"}); ip.IsValid() {
+		t.Fatalf("got %v for a unix address", ip)
+	}
+}
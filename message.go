@@ -0,0 +1,145 @@
+// Copyright 2025 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Message framing module of webtransport package.
+
+package webtransport
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// Errors returned by MessageReader and MessageWriter
+var (
+	// ErrMessageTooLarge is returned for a message larger than the maximum
+	// message size
+	ErrMessageTooLarge = fmt.Errorf("webtransport message too large")
+	// ErrMessageTruncated is returned when the stream ends inside a message
+	ErrMessageTruncated = fmt.Errorf("webtransport message truncated")
+)
+
+// DefaultMaxMessageSize is the default maximum size of a message read or
+// written by MessageReader and MessageWriter.
+const DefaultMaxMessageSize = 1 << 20
+
+// MessageReader reads messages from a stream, e.g. a Stream or a
+// ReceiveStream. Each message is preceded by its length encoded as a QUIC
+// variable-length integer, as written by MessageWriter.
+//
+// After an error the position in the stream is lost, so every further
+// ReadMessage returns the same error. A MessageReader is not safe for
+// concurrent use.
+type MessageReader struct {
+	r   io.Reader
+	err error
+
+	// MaxMessageSize is the maximum size of a message. A larger message
+	// stops the reader with ErrMessageTooLarge. If zero,
+	// DefaultMaxMessageSize is used.
+	MaxMessageSize int
+}
+
+// NewMessageReader creates a new MessageReader reading from r.
+func NewMessageReader(r io.Reader) *MessageReader {
+	return &MessageReader{r: r}
+}
+
+// ReadMessage reads the next message into buf and returns it. The message is
+// read into buf[:0] directly from the stream if it fits in the capacity of
+// buf, otherwise a larger buffer is allocated.
+//
+// ReadMessage returns io.EOF if the stream ended after the last message,
+// ErrMessageTruncated if it ended inside a message and ErrMessageTooLarge if
+// the message is larger than the maximum message size.
+func (m *MessageReader) ReadMessage(buf []byte) ([]byte, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	msg, err := m.readMessage(buf)
+	if err != nil {
+		m.err = err
+	}
+	return msg, err
+}
+
+// readMessage reads the length prefix and the data of the next message.
+func (m *MessageReader) readMessage(buf []byte) ([]byte, error) {
+	// The first byte of the prefix tells the length of the prefix
+	var prefix [8]byte
+	if _, err := io.ReadFull(m.r, prefix[:1]); err != nil {
+		return nil, err
+	}
+	prefixLen := 1 << (prefix[0] >> 6)
+	if _, err := io.ReadFull(m.r, prefix[1:prefixLen]); err != nil {
+		return nil, truncated(err)
+	}
+	size, _, err := quicvarint.Parse(prefix[:prefixLen])
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(maxMessageSize(m.MaxMessageSize)) {
+		return nil, ErrMessageTooLarge
+	}
+
+	// Read the message data
+	if uint64(cap(buf)) < size {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+	if _, err := io.ReadFull(m.r, buf); err != nil {
+		return nil, truncated(err)
+	}
+	return buf, nil
+}
+
+// truncated returns ErrMessageTruncated for the end of the stream inside a
+// message, or the error itself.
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrMessageTruncated
+	}
+	return err
+}
+
+// MessageWriter writes messages to a stream, e.g. a Stream or a SendStream.
+// Each message is preceded by its length encoded as a QUIC variable-length
+// integer. A MessageWriter is not safe for concurrent use.
+type MessageWriter struct {
+	w   io.Writer
+	buf []byte
+
+	// MaxMessageSize is the maximum size of a message. WriteMessage returns
+	// ErrMessageTooLarge for a larger message. If zero, DefaultMaxMessageSize
+	// is used.
+	MaxMessageSize int
+}
+
+// NewMessageWriter creates a new MessageWriter writing to w.
+func NewMessageWriter(w io.Writer) *MessageWriter {
+	return &MessageWriter{w: w}
+}
+
+// WriteMessage writes a message with its length prefix to the stream in one
+// write.
+func (m *MessageWriter) WriteMessage(p []byte) error {
+	if len(p) > maxMessageSize(m.MaxMessageSize) {
+		return ErrMessageTooLarge
+	}
+	m.buf = quicvarint.Append(m.buf[:0], uint64(len(p)))
+	m.buf = append(m.buf, p...)
+	_, err := m.w.Write(m.buf)
+	return err
+}
+
+// maxMessageSize returns the maximum message size, or DefaultMaxMessageSize if
+// it is zero.
+func maxMessageSize(size int) int {
+	if size == 0 {
+		return DefaultMaxMessageSize
+	}
+	return size
+}
@@ -0,0 +1,131 @@
+package webtransport
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+func TestMessageReadWrite(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewMessageWriter(&buf)
+	msgs := [][]byte{[]byte("hello"), {}, bytes.Repeat([]byte{1}, 100),
+		bytes.Repeat([]byte{2}, 20000)}
+	for _, msg := range msgs {
+		if err := w.WriteMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewMessageReader(&buf)
+	for i, want := range msgs {
+		got, err := r.ReadMessage(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("message %d: got %d bytes, want %d", i, len(got), len(want))
+		}
+	}
+	if _, err := r.ReadMessage(nil); err != io.EOF {
+		t.Fatalf("got %v after the last message, want io.EOF", err)
+	}
+}
+
+func TestMessageReadBuffer(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewMessageWriter(&buf)
+	w.WriteMessage([]byte("abc"))
+	w.WriteMessage([]byte("longer message"))
+
+	// A message which fits is read into the buffer
+	r := NewMessageReader(&buf)
+	b := make([]byte, 8)
+	msg, err := r.ReadMessage(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != "abc" || &msg[0] != &b[0] {
+		t.Fatalf("got %q not read into the buffer", msg)
+	}
+
+	// A larger one is allocated
+	msg, err = r.ReadMessage(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != "longer message" {
+		t.Fatalf("got %q", msg)
+	}
+}
+
+func TestMessageTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewMessageWriter(&buf)
+	w.MaxMessageSize = 4
+	if err := w.WriteMessage([]byte("12345")); err != ErrMessageTooLarge {
+		t.Fatalf("write: got %v, want ErrMessageTooLarge", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatal("the message was written")
+	}
+
+	// A length prefix beyond the maximum is rejected without reading the
+	// message, and the reader stays stopped
+	buf.Write(quicvarint.Append(nil, 1<<40))
+	r := NewMessageReader(&buf)
+	for range 2 {
+		if _, err := r.ReadMessage(nil); err != ErrMessageTooLarge {
+			t.Fatalf("read: got %v, want ErrMessageTooLarge", err)
+		}
+	}
+}
+
+func TestMessageTruncated(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x40},           // two byte prefix with one byte
+		{0x05, 'a', 'b'}, // five byte message with two bytes
+	} {
+		r := NewMessageReader(bytes.NewReader(data))
+		if _, err := r.ReadMessage(nil); err != ErrMessageTruncated {
+			t.Errorf("%x: got %v, want ErrMessageTruncated", data, err)
+		}
+	}
+}
+
+func TestMessageStream(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	str, err := client.OpenUniStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewMessageWriter(&str)
+	for _, msg := range []string{"one", "two"} {
+		if err := w.WriteMessage([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	str.Close()
+
+	accepted, err := server.AcceptUniStream(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewMessageReader(&accepted)
+	for _, want := range []string{"one", "two"} {
+		msg, err := r.ReadMessage(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(msg) != want {
+			t.Fatalf("got %q, want %q", msg, want)
+		}
+	}
+	if _, err := r.ReadMessage(nil); err != io.EOF {
+		t.Fatalf("got %v after the last message, want io.EOF", err)
+	}
+}
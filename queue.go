@@ -0,0 +1,108 @@
+// Copyright 2025 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Accept queue module of webtransport package.
+
+package webtransport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Errors returned by acceptQueue.push
+var (
+	errQueueClosed = fmt.Errorf("accept queue closed")
+	errQueueFull   = fmt.Errorf("accept queue full")
+)
+
+// acceptQueue is a queue of incoming streams of a WebTransport session.
+type acceptQueue[T any] struct {
+	mu     sync.Mutex
+	items  []T
+	max    int // maximum number of items, not limited if zero
+	closed bool
+	notify chan struct{}
+}
+
+// newAcceptQueue creates a new empty acceptQueue holding up to max items. If
+// max is zero, the number of items is not limited.
+func newAcceptQueue[T any](max int) *acceptQueue[T] {
+	return &acceptQueue[T]{max: max, notify: make(chan struct{}, 1)}
+}
+
+// push adds an item to the end of the queue and wakes up a waiting pop. It
+// returns errQueueClosed if the queue is closed and errQueueFull if the queue
+// holds the maximum number of items.
+func (q *acceptQueue[T]) push(item T) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return errQueueClosed
+	}
+	if q.max > 0 && len(q.items) >= q.max {
+		q.mu.Unlock()
+		return errQueueFull
+	}
+	q.items = append(q.items, item)
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// len returns the number of items in the queue.
+func (q *acceptQueue[T]) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// close closes the queue and returns the items which were not popped.
+func (q *acceptQueue[T]) close() []T {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	items := q.items
+	q.items = nil
+	return items
+}
+
+// pop removes and returns the first item of the queue, blocking until one is
+// available, the context is canceled or the done channel is closed.
+func (q *acceptQueue[T]) pop(ctx context.Context, done <-chan struct{}) (T, error) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			item := q.items[0]
+			q.items = q.items[1:]
+			more := len(q.items) > 0
+			q.mu.Unlock()
+
+			// Pass the wake up on to the next waiting pop
+			if more {
+				select {
+				case q.notify <- struct{}{}:
+				default:
+				}
+			}
+			return item, nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.notify:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		case <-done:
+			var zero T
+			return zero, ErrSTreamClosed
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package webtransport
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+func TestAcceptQueue(t *testing.T) {
+	q := newAcceptQueue[int](2)
+	for i := range 2 {
+		if err := q.push(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.push(2); err != errQueueFull {
+		t.Fatalf("got %v, want errQueueFull", err)
+	}
+	if n := q.len(); n != 2 {
+		t.Fatalf("got length %d, want 2", n)
+	}
+
+	// Items are popped in order
+	for want := range 2 {
+		got, err := q.pop(context.Background(), nil)
+		if err != nil || got != want {
+			t.Fatalf("got %d, %v, want %d", got, err, want)
+		}
+	}
+
+	// An empty queue blocks until the context or the done channel ends
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := q.pop(ctx, nil); err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	done := make(chan struct{})
+	close(done)
+	if _, err := q.pop(context.Background(), done); err != ErrSTreamClosed {
+		t.Fatalf("got %v, want ErrSTreamClosed", err)
+	}
+
+	q.push(3)
+	if items := q.close(); len(items) != 1 || items[0] != 3 {
+		t.Fatalf("close returned %v", items)
+	}
+	if err := q.push(4); err != errQueueClosed {
+		t.Fatalf("got %v, want errQueueClosed", err)
+	}
+}
+
+func TestAcceptQueueWakesPop(t *testing.T) {
+	q := newAcceptQueue[int](0)
+	popped := make(chan int)
+	go func() {
+		item, _ := q.pop(testContext(t), nil)
+		popped <- item
+	}()
+	q.push(7)
+	select {
+	case item := <-popped:
+		if item != 7 {
+			t.Fatalf("got %d, want 7", item)
+		}
+	case <-testContext(t).Done():
+		t.Fatal("pop was not woken up")
+	}
+}
+
+func TestPendingStreamsLimit(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{MaxPendingStreams: 2})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	open := func() Stream {
+		str, err := client.OpenStream()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := str.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		return str
+	}
+	open()
+	open()
+	waitFor(t, "two pending streams", func() bool {
+		bidi, _ := server.PendingStreams()
+		return bidi == 2
+	})
+
+	// The queue is full, so the next stream is reset
+	str := open()
+	_, err := str.Read(make([]byte, 1))
+	var streamErr *quic.StreamError
+	if !errors.As(err, &streamErr) ||
+		streamErr.ErrorCode != h3.WEBTRANSPORT_BUFFERED_STREAM_REJECTED {
+		t.Fatalf("got %v, want a reset with WEBTRANSPORT_BUFFERED_STREAM_REJECTED", err)
+	}
+
+	// Accepting a stream makes room for another one
+	if _, err := server.AcceptStream(); err != nil {
+		t.Fatal(err)
+	}
+	open()
+	waitFor(t, "two pending streams", func() bool {
+		bidi, _ := server.PendingStreams()
+		return bidi == 2
+	})
+}
@@ -0,0 +1,189 @@
+// Copyright 2025 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Receive buffer module of webtransport package.
+
+package webtransport
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// recvChunkSize is the size of the reads from a QUIC stream into its receive
+// buffer.
+const recvChunkSize = 16 << 10
+
+// recvBuffer reads the data of a stream of a session as it arrives, so that
+// the data is counted against the data limit of the session when it is
+// received rather than when the application reads it. The data stays in the
+// buffer until it is read; the data limit of the session bounds the buffered
+// data of all its streams.
+type recvBuffer struct {
+	str      quic.ReceiveStream
+	session  *Session
+	deadline deadline
+	notify   chan struct{} // signaled when data or an error is added
+
+	mu        sync.Mutex
+	data      []byte // received data which was not read yet
+	err       error  // error which ended the stream, returned after the data
+	discarded bool   // the application stopped reading
+}
+
+// newRecvBuffer creates a receive buffer for the stream and starts reading
+// the stream into it.
+func newRecvBuffer(s *Session, str quic.ReceiveStream) *recvBuffer {
+	b := &recvBuffer{str: str, session: s, notify: make(chan struct{}, 1)}
+	go b.fill()
+	return b
+}
+
+// fill reads the stream into the buffer until the stream ends. Data beyond
+// the data limit of the session is dropped, as the session is closed with a
+// flow control error, which resets the stream.
+func (b *recvBuffer) fill() {
+	chunk := make([]byte, recvChunkSize)
+	for {
+		n, err := b.str.Read(chunk)
+		keep := n > 0 && b.session.dataReceived(n)
+
+		b.mu.Lock()
+		if keep {
+			b.data = append(b.data, chunk[:n]...)
+		}
+		var dropped int
+		if err != nil {
+			b.err = err
+		}
+		// A reset stream drops its data, as a QUIC stream does
+		if b.discarded || err != nil && err != io.EOF {
+			dropped = len(b.data)
+			b.data = nil
+		}
+		b.mu.Unlock()
+
+		b.session.dataConsumed(dropped)
+		select {
+		case b.notify <- struct{}{}:
+		default:
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// read reads up to len(p) bytes from the buffer, blocking until data is
+// available, the stream ends or the read deadline expires.
+func (b *recvBuffer) read(p []byte) (int, error) {
+	for {
+		expired := b.deadline.wait()
+		if isClosed(expired) {
+			return 0, os.ErrDeadlineExceeded
+		}
+
+		b.mu.Lock()
+		if len(b.data) > 0 {
+			n := copy(p, b.data)
+			b.data = b.data[n:]
+			if len(b.data) == 0 {
+				b.data = nil
+			}
+			b.mu.Unlock()
+			b.session.dataConsumed(n)
+			return n, nil
+		}
+		err := b.err
+		b.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+
+		select {
+		case <-b.notify:
+		case <-expired:
+		}
+	}
+}
+
+// discard drops the buffered data after the application stopped reading,
+// releasing it from the data limit of the session. Data which was still in
+// flight when the stream was canceled is dropped by QUIC without being seen,
+// so it is neither counted nor released.
+func (b *recvBuffer) discard() {
+	b.mu.Lock()
+	dropped := len(b.data)
+	b.data = nil
+	b.discarded = true
+	b.mu.Unlock()
+	b.session.dataConsumed(dropped)
+}
+
+// bufferedStream is a bidirectional QUIC stream whose received data is read
+// through a recvBuffer.
+type bufferedStream struct {
+	quic.Stream
+	recv *recvBuffer
+}
+
+func (s bufferedStream) Read(p []byte) (int, error) { return s.recv.read(p) }
+
+func (s bufferedStream) CancelRead(code quic.StreamErrorCode) {
+	s.Stream.CancelRead(code)
+	s.recv.discard()
+}
+
+func (s bufferedStream) SetReadDeadline(t time.Time) error {
+	s.recv.deadline.set(t)
+	return nil
+}
+
+func (s bufferedStream) SetDeadline(t time.Time) error {
+	s.recv.deadline.set(t)
+	return s.Stream.SetWriteDeadline(t)
+}
+
+// bufferedReceiveStream is a unidirectional QUIC stream whose data is read
+// through a recvBuffer.
+type bufferedReceiveStream struct {
+	quic.ReceiveStream
+	recv *recvBuffer
+}
+
+func (s bufferedReceiveStream) Read(p []byte) (int, error) { return s.recv.read(p) }
+
+func (s bufferedReceiveStream) CancelRead(code quic.StreamErrorCode) {
+	s.ReceiveStream.CancelRead(code)
+	s.recv.discard()
+}
+
+func (s bufferedReceiveStream) SetReadDeadline(t time.Time) error {
+	s.recv.deadline.set(t)
+	return nil
+}
+
+// bufferStream returns the bidirectional stream reading its data through a
+// receive buffer if the session limits the data it receives, or the stream
+// itself otherwise.
+func (s *Session) bufferStream(str quic.Stream) quic.Stream {
+	if !s.limitsData() {
+		return str
+	}
+	return bufferedStream{Stream: str, recv: newRecvBuffer(s, str)}
+}
+
+// bufferReceiveStream returns the unidirectional stream reading its data
+// through a receive buffer if the session limits the data it receives, or the
+// stream itself otherwise.
+func (s *Session) bufferReceiveStream(str quic.ReceiveStream) quic.ReceiveStream {
+	if !s.limitsData() {
+		return str
+	}
+	return bufferedReceiveStream{ReceiveStream: str, recv: newRecvBuffer(s, str)}
+}
@@ -0,0 +1,114 @@
+// Copyright 2025 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Session registry module of webtransport package.
+
+package webtransport
+
+import (
+	"cmp"
+	"fmt"
+	"iter"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// ErrSessionNotFound is returned by Server.CloseSession if the server has no
+// active session with the given ID.
+var ErrSessionNotFound = fmt.Errorf("webtransport session not found")
+
+// SessionInfo describes an active WebTransport session of a Server.
+type SessionInfo struct {
+	// ID is the ID of the session, unique within the server
+	ID uint64
+	// RemoteAddr is the address of the client
+	RemoteAddr net.Addr
+	// Path is the path of the request URL
+	Path string
+	// Origin is the value of the Origin request header
+	Origin string
+	// Started is the time when the session was established
+	Started time.Time
+	// Draft is the negotiated WebTransport over HTTP/3 draft
+	Draft Draft
+	// Session is the session itself
+	Session *Session
+}
+
+// registry holds the active WebTransport sessions of a Server. It is
+// protected by the Server mutex.
+type registry struct {
+	lastID   uint64
+	sessions map[uint64]SessionInfo
+}
+
+// Sessions returns an iterator over the active WebTransport sessions of the
+// server, in the order they were established. The iterator yields a snapshot
+// taken when the iteration starts, so sessions may be closed while iterating.
+func (s *Server) Sessions() iter.Seq[SessionInfo] {
+	return func(yield func(SessionInfo) bool) {
+		s.mu.Lock()
+		infos := slices.SortedFunc(maps.Values(s.registry.sessions),
+			func(a, b SessionInfo) int { return cmp.Compare(a.ID, b.ID) })
+		s.mu.Unlock()
+
+		for _, info := range infos {
+			if !yield(info) {
+				return
+			}
+		}
+	}
+}
+
+// LookupSession returns the active WebTransport session with the given ID. The
+// ok result is false if there is no such session.
+func (s *Server) LookupSession(id uint64) (info SessionInfo, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok = s.registry.sessions[id]
+	return
+}
+
+// CloseSession closes the active WebTransport session with the given ID with
+// the supplied error code and reason, as Session.CloseWithError does. It
+// returns ErrSessionNotFound if there is no such session, and
+// ErrSessionNotAccepted if the handler has not accepted the session yet.
+func (s *Server) CloseSession(id uint64, code SessionErrorCode, reason string) error {
+	info, ok := s.LookupSession(id)
+	if !ok {
+		return ErrSessionNotFound
+	}
+	return info.Session.CloseWithError(code, reason)
+}
+
+// registerSession adds an established session to the registry and assigns it
+// an ID.
+func (s *Server) registerSession(session *Session, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.registry.sessions == nil {
+		s.registry.sessions = make(map[uint64]SessionInfo)
+	}
+	s.registry.lastID++
+	session.id = s.registry.lastID
+	s.registry.sessions[session.id] = SessionInfo{
+		ID:         session.id,
+		RemoteAddr: session.Session.RemoteAddr(),
+		Path:       req.URL.Path,
+		Origin:     req.Header.Get("origin"),
+		Started:    time.Now(),
+		Draft:      session.draft,
+		Session:    session,
+	}
+}
+
+// unregisterSession removes an ended session from the registry.
+func (s *Server) unregisterSession(session *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.registry.sessions, session.id)
+}
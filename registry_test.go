@@ -0,0 +1,58 @@
+package webtransport
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSessionRegistry(t *testing.T) {
+	s := &Server{}
+	url, sessions := startSessionServer(t, s)
+	start := time.Now()
+
+	_, client, err := testDialer().Dial(testContext(t), url+"/one",
+		http.Header{"Origin": {"https://example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.CloseSession() })
+	server1 := acceptedSession(t, sessions)
+	_, server2 := dialSession(t, nil, url+"/two", sessions)
+
+	infos := slices.Collect(s.Sessions())
+	if len(infos) != 2 || infos[0].Session != server1 || infos[1].Session != server2 {
+		t.Fatalf("got %+v", infos)
+	}
+
+	info, ok := s.LookupSession(server1.ID())
+	if !ok {
+		t.Fatal("the session was not found")
+	}
+	if info.ID != server1.ID() || info.Path != "/one" ||
+		info.Origin != "https://example.com" || info.Draft != server1.Draft() ||
+		info.RemoteAddr == nil || info.Started.Before(start) {
+		t.Fatalf("got %+v", info)
+	}
+
+	// The iteration can be stopped
+	for range s.Sessions() {
+		break
+	}
+
+	// A closed session is removed
+	if err := s.CloseSession(server1.ID(), 4, "kicked"); err != nil {
+		t.Fatal(err)
+	}
+	if e := sessionError(t, client); e.ErrorCode != 4 || e.Message != "kicked" {
+		t.Fatalf("got %+v", e)
+	}
+	waitFor(t, "the session to be removed", func() bool {
+		_, ok := s.LookupSession(server1.ID())
+		return !ok
+	})
+	if err := s.CloseSession(server1.ID(), 0, ""); err != ErrSessionNotFound {
+		t.Fatalf("got %v, want ErrSessionNotFound", err)
+	}
+}
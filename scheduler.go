@@ -0,0 +1,220 @@
+// Copyright 2025 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Send scheduler module of webtransport package.
+
+package webtransport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// ErrInvalidSendGroup is returned when a stream is opened with a SendGroup of
+// another WebTransport session.
+var ErrInvalidSendGroup = fmt.Errorf("send group belongs to another webtransport session")
+
+// sendChunkSize is the largest amount of data written to a stream in one turn
+// of the send scheduler. It bounds how long an urgent write waits for a write
+// of lower priority which is in progress.
+const sendChunkSize = 16 << 10
+
+// sendTurnTimeout is the longest time a write keeps its turn of the send
+// scheduler. A write which takes longer, e.g. because the stream is blocked by
+// the QUIC flow control of the peer, goes on without the turn, so that it does
+// not hold up the writes to the other streams of the session.
+const sendTurnTimeout = 10 * time.Millisecond
+
+// A SendGroup is a group of outgoing streams of a WebTransport session, as the
+// sendGroup of the W3C WebTransport API. The groups of a session share the
+// bandwidth of the session fairly, while the streams of a group are sent in
+// the order of their send order. Streams opened with StreamOptions without a
+// SendGroup belong to the default group of the session, while streams opened
+// without StreamOptions are not scheduled at all.
+type SendGroup struct {
+	session *Session
+	served  uint64 // the turn the group was last served in
+}
+
+// StreamOptions are the options of a stream opened with
+// Session.OpenStreamWithOptions or Session.OpenUniStreamWithOptions.
+type StreamOptions struct {
+	// SendGroup is the group of the stream. If nil, the stream belongs to the
+	// default group of the session.
+	SendGroup *SendGroup
+	// SendOrder is the send order of the stream within its group. Data of
+	// streams with a higher send order is sent first; streams with the same
+	// send order share the bandwidth of their group.
+	SendOrder int64
+}
+
+// NewSendGroup creates a new SendGroup of the session.
+func (s *Session) NewSendGroup() *SendGroup {
+	return &SendGroup{session: s}
+}
+
+// sendPriority is the priority of an outgoing stream of a session.
+type sendPriority struct {
+	group *SendGroup
+	order atomic.Int64
+}
+
+// newSendPriority creates the priority of a stream of the session from the
+// stream options. A stream opened without options has no priority.
+func (s *Session) newSendPriority(opts *StreamOptions) (*sendPriority, error) {
+	if opts == nil {
+		return nil, nil
+	}
+	if opts.SendGroup != nil && opts.SendGroup.session != s {
+		return nil, ErrInvalidSendGroup
+	}
+	p := &sendPriority{group: opts.SendGroup}
+	p.order.Store(opts.SendOrder)
+	return p, nil
+}
+
+// sendTurn is a write waiting for its turn in the send scheduler.
+type sendTurn struct {
+	priority *sendPriority
+	seq      uint64        // arrival order of the write
+	ready    chan struct{} // closed when the turn is granted
+}
+
+// scheduler orders the writes to the streams of a session which have a
+// priority. Data is written to one stream at a time, in chunks of up to
+// sendChunkSize bytes, so that the QUIC connection sends the data of the
+// stream which got the turn. Turns
+// are granted to the least recently served send group, and within a group to
+// the stream with the highest send order, streams with the same send order
+// taking turns.
+type scheduler struct {
+	mu      sync.Mutex
+	busy    bool // a turn is granted
+	waiting []*sendTurn
+	seq     uint64
+	turns   uint64
+	// served is the turn the default group was last served in
+	served uint64
+}
+
+// acquire waits for a turn to write to a stream with the given priority. It
+// returns an error if the context is done or the done channel is closed
+// first. A granted turn must be released with release.
+func (q *scheduler) acquire(ctx context.Context, done <-chan struct{},
+	priority *sendPriority) error {
+
+	q.mu.Lock()
+	if !q.busy {
+		q.busy = true
+		q.serve(priority.group)
+		q.mu.Unlock()
+		return nil
+	}
+	t := &sendTurn{priority: priority, seq: q.seq, ready: make(chan struct{})}
+	q.seq++
+	q.waiting = append(q.waiting, t)
+	q.mu.Unlock()
+
+	var err error
+	select {
+	case <-t.ready:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-done:
+		err = ErrSTreamClosed
+	}
+
+	// Give up waiting, or pass on a turn which was granted meanwhile
+	q.mu.Lock()
+	i := q.index(t)
+	if i >= 0 {
+		q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+	}
+	q.mu.Unlock()
+	if i < 0 {
+		q.release()
+	}
+	return err
+}
+
+// write writes p to the stream in a granted turn and releases the turn. The
+// turn is released early if the write does not return within sendTurnTimeout.
+func (q *scheduler) write(str quic.SendStream, p []byte) (int, error) {
+	var once sync.Once
+	release := func() { once.Do(q.release) }
+	timer := time.AfterFunc(sendTurnTimeout, release)
+	n, err := str.Write(p)
+	timer.Stop()
+	release()
+	return n, err
+}
+
+// release ends a granted turn and grants the next one.
+func (q *scheduler) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.waiting) == 0 {
+		q.busy = false
+		return
+	}
+	i := q.next()
+	t := q.waiting[i]
+	q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+	q.serve(t.priority.group)
+	close(t.ready)
+}
+
+// next returns the index of the waiting write which gets the next turn.
+func (q *scheduler) next() int {
+	best := 0
+	for i, t := range q.waiting[1:] {
+		if q.before(t, q.waiting[best]) {
+			best = i + 1
+		}
+	}
+	return best
+}
+
+// before reports whether the write a gets its turn before the write b.
+func (q *scheduler) before(a, b *sendTurn) bool {
+	if a.priority.group != b.priority.group {
+		return *q.lastServed(a.priority.group) < *q.lastServed(b.priority.group)
+	}
+	orderA, orderB := a.priority.order.Load(), b.priority.order.Load()
+	if orderA != orderB {
+		return orderA > orderB
+	}
+	return a.seq < b.seq
+}
+
+// serve records that the group is served in the current turn.
+func (q *scheduler) serve(group *SendGroup) {
+	q.turns++
+	*q.lastServed(group) = q.turns
+}
+
+// lastServed returns the turn the group was last served in; a nil group is
+// the default group of the session.
+func (q *scheduler) lastServed(group *SendGroup) *uint64 {
+	if group == nil {
+		return &q.served
+	}
+	return &group.served
+}
+
+// index returns the index of the waiting write, or -1 if it is not waiting.
+func (q *scheduler) index(t *sendTurn) int {
+	for i, w := range q.waiting {
+		if w == t {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,161 @@
+package webtransport
+
+import (
+	"context"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// grantOrder holds a turn of a new scheduler while writes with the
+// priorities wait for their turns, and returns the indexes of the priorities
+// in the order the turns are granted.
+func grantOrder(t *testing.T, priorities ...*sendPriority) []int {
+	t.Helper()
+	q := &scheduler{}
+	if err := q.acquire(context.Background(), nil, &sendPriority{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i, p := range priorities {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := q.acquire(context.Background(), nil, p); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			q.release()
+		}()
+		// Queue the writes in order
+		waitFor(t, "the write to wait", func() bool {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			return len(q.waiting) == i+1
+		})
+	}
+	q.release()
+	wg.Wait()
+	return order
+}
+
+// priority returns a send priority in the group with the send order.
+func priority(group *SendGroup, order int64) *sendPriority {
+	p := &sendPriority{group: group}
+	p.order.Store(order)
+	return p
+}
+
+func TestSchedulerSendOrder(t *testing.T) {
+	order := grantOrder(t, priority(nil, 0), priority(nil, 5), priority(nil, 1),
+		priority(nil, 5))
+
+	// Higher send orders first, equal send orders in arrival order
+	if want := []int{1, 3, 2, 0}; !slices.Equal(order, want) {
+		t.Fatalf("got turns %v, want %v", order, want)
+	}
+}
+
+func TestSchedulerSendGroups(t *testing.T) {
+	a, b := &SendGroup{}, &SendGroup{}
+	order := grantOrder(t, priority(a, 1), priority(a, 2), priority(b, 0),
+		priority(b, 0))
+
+	// The groups take turns, whatever the send orders of their streams
+	if want := []int{1, 2, 0, 3}; !slices.Equal(order, want) {
+		t.Fatalf("got turns %v, want %v", order, want)
+	}
+}
+
+func TestSchedulerAcquireCanceled(t *testing.T) {
+	q := &scheduler{}
+	if err := q.acquire(context.Background(), nil, &sendPriority{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := q.acquire(ctx, nil, &sendPriority{}); err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if len(q.waiting) != 0 {
+		t.Fatal("the canceled write is still waiting")
+	}
+}
+
+// TestSchedulerBlockedStream checks that a stream blocked by the QUIC flow
+// control of the peer does not hold up the other streams of the session.
+func TestSchedulerBlockedStream(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts *StreamOptions
+	}{
+		{"not scheduled", nil},
+		{"scheduled", &StreamOptions{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			url, sessions := startSessionServer(t, &Server{})
+			client, server := dialSession(t, nil, url+"/wt", sessions)
+			ctx := testContext(t)
+			open := func() Stream {
+				t.Helper()
+				var str Stream
+				var err error
+				if tt.opts != nil {
+					str, err = client.OpenStreamWithOptions(ctx, *tt.opts)
+				} else {
+					str, err = client.OpenStreamSync(ctx)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				return str
+			}
+
+			// Stream A writes more than the peer accepts without reading
+			a := open()
+			go a.Write(make([]byte, 20<<20))
+			waitFor(t, "stream A to be blocked", func() bool {
+				// More than the initial QUIC stream window of 512 KiB
+				client.flowControl.mu.Lock()
+				defer client.flowControl.mu.Unlock()
+				return client.flowControl.sendData.used > 512<<10
+			})
+			if _, err := server.AcceptStream(); err != nil {
+				t.Fatal(err)
+			}
+
+			// A byte written to stream B arrives meanwhile
+			b := open()
+			received := make(chan error, 1)
+			go func() {
+				if _, err := b.Write([]byte{1}); err != nil {
+					received <- err
+					return
+				}
+				accepted, err := server.AcceptStream()
+				if err != nil {
+					received <- err
+					return
+				}
+				_, err = io.ReadFull(accepted, make([]byte, 1))
+				received <- err
+			}()
+			select {
+			case err := <-received:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(testTimeout):
+				t.Fatal("the byte written to stream B did not arrive")
+			}
+		})
+	}
+}
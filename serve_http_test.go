@@ -0,0 +1,74 @@
+package webtransport
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// httpClient returns an HTTP/3 client which trusts any server certificate.
+func httpClient(t *testing.T) *http.Client {
+	tr := &http3.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	t.Cleanup(func() { tr.Close() })
+	return &http.Client{Transport: tr, Timeout: testTimeout}
+}
+
+func TestServeHTTP(t *testing.T) {
+	s := &Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /hello", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "hello")
+	})
+	mux.HandleFunc("POST /echo", func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	})
+	s.Handler = mux
+	url := startServer(t, s)
+	client := httpClient(t)
+
+	resp, err := client.Get(url + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "hello" ||
+		resp.Header.Get("Content-Type") != "text/plain" {
+		t.Fatalf("got %d %q with headers %v", resp.StatusCode, body, resp.Header)
+	}
+
+	// The request body is passed to the handler
+	data := strings.Repeat("data", 10000)
+	resp, err = client.Post(url+"/echo", "text/plain", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != data {
+		t.Fatalf("got %d bytes echoed, want %d", len(body), len(data))
+	}
+
+	// Unknown paths get the handler's answer
+	resp, err = client.Get(url + "/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("got status %d, want 404", resp.StatusCode)
+	}
+}
@@ -9,7 +9,13 @@ package webtransport
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
+	"maps"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/quicvarint"
@@ -18,15 +24,260 @@ import (
 
 // Session is a WebTransport session (and the Body of a WebTransport http.Request)
 // wrapping the request stream (a quic.Stream), the two control streams and a
-// quic.Connection.
+// quic.Connection. The control streams are only set on the server side.
 type Session struct {
 	quic.Stream
 	Session             quic.Connection
 	ClientControlStream quic.ReceiveStream
 	ServerControlStream quic.SendStream
+	conn                *conn
+	id                  uint64 // ID in the server registry, zero on the client
+	draft               Draft
+	bidiStreams         *acceptQueue[quic.Stream]
+	uniStreams          *acceptQueue[quic.ReceiveStream]
+	datagrams           chan []byte
+	drain               chan struct{}
+	watchDone           chan struct{} // closed when the request stream is read
+	drainOnce           sync.Once
 	responseWriter      *h3.ResponseWriter
+	writeMu             sync.Mutex // serializes capsule writes
+	accepted            bool       // capsules may be written
 	context             context.Context
-	cancel              context.CancelFunc
+	cancel              context.CancelCauseFunc
+
+	mu          sync.Mutex
+	err         *SessionError // the error which ended the session
+	streams     map[quic.StreamID]trackedStream
+	flowControl flowControl
+	scheduler   scheduler
+	reset       bool          // the streams were reset, new streams are reset right away
+	stopWatch   []func() bool // unregister the functions ending the session
+
+	// Idle timeout and keepalive; lastActivity is the time of the last
+	// activity in Unix nanoseconds
+	lastActivity    atomic.Int64
+	idleTimeout     time.Duration
+	idleTimer       *time.Timer
+	keepAlivePeriod time.Duration
+	keepAliveTimer  *time.Timer
+
+	// release releases the session from the server admission control
+	release func()
+}
+
+// newSession creates a new WebTransport session on the request stream of the
+// connection c. The session context carries the values of the supplied parent
+// context and ends when the parent context is done, the request stream is
+// closed or the session is closed.
+func newSession(c *conn, requestStream quic.Stream, draft Draft,
+	parent context.Context) *Session {
+
+	ctx, cancel := context.WithCancelCause(context.WithoutCancel(parent))
+	s := &Session{
+		Stream:      requestStream,
+		Session:     c.Connection,
+		conn:        c,
+		draft:       draft,
+		bidiStreams: newAcceptQueue[quic.Stream](c.maxPendingStreams),
+		uniStreams:  newAcceptQueue[quic.ReceiveStream](c.maxPendingStreams),
+		datagrams:   make(chan []byte, datagramQueueLen),
+		drain:       make(chan struct{}),
+		watchDone:   make(chan struct{}),
+		context:     ctx,
+		cancel:      cancel,
+	}
+	if c.server != nil {
+		s.ClientControlStream = c.peerControlStream
+		s.ServerControlStream = c.controlStream
+	} else {
+		// The client creates the session after the server accepted it
+		s.accepted = true
+	}
+	s.initFlowControl()
+	s.touch()
+
+	// End the session when its connection or request stream ends. The
+	// functions are unregistered when the session ends, so that the
+	// connection context does not keep ended sessions alive.
+	stopConn := context.AfterFunc(parent, func() {
+		s.end(s.closeError(context.Cause(parent)))
+	})
+	stopRequest := context.AfterFunc(requestStream.Context(), func() {
+		s.end(s.closeError(context.Cause(requestStream.Context())))
+	})
+	s.mu.Lock()
+	s.stopWatch = []func() bool{stopConn, stopRequest}
+	ended := s.err != nil
+	s.mu.Unlock()
+	if ended {
+		stopConn()
+		stopRequest()
+	}
+
+	return s
+}
+
+// watchRequestStream reads the capsules received on the request stream until
+// the peer closes it or sends a CLOSE_WEBTRANSPORT_SESSION capsule, and then
+// ends the session. The session is removed from its connection when it ends.
+func (s *Session) watchRequestStream() {
+	go func() {
+		<-s.context.Done()
+		s.conn.removeSession(s.StreamID())
+
+		if s.release != nil {
+			s.release()
+		}
+		if srv := s.conn.server; srv != nil {
+			srv.unregisterSession(s)
+			if srv.OnSessionEnd != nil {
+				srv.OnSessionEnd(s, s.Err())
+			}
+		}
+	}()
+
+	// Capsules are sent in the data of the request stream
+	body := h3.NewBody(s.Stream)
+	for {
+		capsule := h3.Capsule{}
+		if err := capsule.Read(body); err != nil {
+			// Closing the request stream closes the session cleanly, while a
+			// malformed capsule makes the request malformed, which resets
+			// the request stream (RFC 9297, Section 3.3)
+			switch {
+			case err == io.EOF:
+				s.end(&SessionError{Remote: true, Cause: CloseCauseCapsule})
+			case malformedRequest(err):
+				s.end(&SessionError{Cause: CloseCauseStreamReset, Err: err})
+				s.Stream.CancelRead(h3.H3_MESSAGE_ERROR)
+				s.Stream.CancelWrite(h3.H3_MESSAGE_ERROR)
+			default:
+				s.end(s.closeError(err))
+			}
+			break
+		}
+		s.touch()
+
+		switch capsule.Type {
+		case h3.CAPSULE_CLOSE_WEBTRANSPORT_SESSION:
+			code, msg, _ := capsule.CloseInfo()
+			s.end(&SessionError{
+				ErrorCode: SessionErrorCode(code),
+				Message:   msg,
+				Remote:    true,
+				Cause:     CloseCauseCapsule,
+			})
+		case h3.CAPSULE_DRAIN_WEBTRANSPORT_SESSION:
+			s.drainOnce.Do(func() { close(s.drain) })
+		case h3.CAPSULE_WT_MAX_DATA, h3.CAPSULE_WT_MAX_STREAMS_BIDI,
+			h3.CAPSULE_WT_MAX_STREAMS_UNI:
+			s.handleLimitCapsule(capsule)
+		}
+		if s.context.Err() != nil {
+			break
+		}
+	}
+	s.Stream.Close()
+	close(s.watchDone)
+}
+
+// writeCapsule writes a capsule in a DATA frame to the request stream. On the
+// server side capsules can only be written after the session was accepted.
+func (s *Session) writeCapsule(capsule h3.Capsule) error {
+	buf := &bytes.Buffer{}
+	capsule.Write(buf)
+	dataFrame := h3.Frame{
+		Type:   h3.FRAME_DATA,
+		Length: uint64(buf.Len()),
+		Data:   buf.Bytes(),
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if !s.accepted {
+		return ErrSessionNotAccepted
+	}
+	_, err := dataFrame.Write(s.Stream)
+	return err
+}
+
+// end ends the session with the given error and resets the streams of the
+// session. Only the first call has an effect.
+func (s *Session) end(err *SessionError) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.stopTimers()
+	stopWatch := s.stopWatch
+	s.stopWatch = nil
+	s.mu.Unlock()
+	for _, stop := range stopWatch {
+		stop()
+	}
+	s.cancel(err)
+	s.resetStreams()
+}
+
+// closeError returns the SessionError for an error which ended the request
+// stream or the connection of the session.
+func (s *Session) closeError(err error) *SessionError {
+	// The connection error is preferred, as it also ends the request stream
+	if connErr := context.Cause(s.conn.Context()); connErr != nil {
+		err = connErr
+	}
+
+	var sessionErr *SessionError
+	var streamErr *quic.StreamError
+	var appErr *quic.ApplicationError
+	var transportErr *quic.TransportError
+	switch {
+	case errors.As(err, &sessionErr):
+		return sessionErr
+	case errors.As(err, &streamErr):
+		return &SessionError{
+			Remote: streamErr.Remote,
+			Cause:  CloseCauseStreamReset,
+			Err:    err,
+		}
+	case errors.As(err, &appErr):
+		return &SessionError{
+			Remote: appErr.Remote,
+			Cause:  CloseCauseConnection,
+			Err:    err,
+		}
+	case errors.As(err, &transportErr):
+		return &SessionError{
+			Remote: transportErr.Remote,
+			Cause:  CloseCauseConnection,
+			Err:    err,
+		}
+	}
+	return &SessionError{Cause: CloseCauseConnection, Err: err}
+}
+
+// malformedRequest reports whether an error reading the capsules of the
+// request stream means that the request is malformed: a capsule is malformed
+// or truncated, or a frame other than DATA was received.
+func malformedRequest(err error) bool {
+	return errors.Is(err, h3.ErrCapsuleMalformed) ||
+		errors.Is(err, h3.ErrFrameUnexpected) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Err returns nil while the session is active. After the session ended, that
+// is after its Context is done, it returns the *SessionError describing why
+// the session ended.
+func (s *Session) Err() error {
+	if s.context.Err() == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		return nil
+	}
+	return s.err
 }
 
 // Context returns the context for the WebTransport session.
@@ -34,56 +285,117 @@ func (s *Session) Context() context.Context {
 	return s.context
 }
 
+// ID returns the ID of the session in the registry of its Server (see
+// Server.Sessions). It is zero on the client side.
+func (s *Session) ID() uint64 {
+	return s.id
+}
+
+// Draft returns the WebTransport over HTTP/3 draft negotiated for the session.
+func (s *Session) Draft() Draft {
+	return s.draft
+}
+
+// PeerSettings returns the HTTP/3 SETTINGS received from the peer on the
+// connection of the session.
+func (s *Session) PeerSettings() h3.SettingsMap {
+	return maps.Clone(s.conn.peerSettings)
+}
+
+// Draining returns a channel which is closed when the server asks the
+// WebTransport session to finish, e.g. because the server is shutting down, or
+// when the peer sends a DRAIN_WEBTRANSPORT_SESSION capsule. The handler should
+// complete its work and close the session.
+func (s *Session) Draining() <-chan struct{} {
+	return s.drain
+}
+
+// drainSession closes the channel returned by Draining. On the server side the
+// client is asked to finish the session with a DRAIN_WEBTRANSPORT_SESSION
+// capsule.
+func (s *Session) drainSession() {
+	s.drainOnce.Do(func() {
+		close(s.drain)
+		if s.conn.server != nil {
+			go s.writeCapsule(h3.NewDrainCapsule())
+		}
+	})
+}
+
 // AcceptSession accepts an incoming WebTransport session. Call it in your
 // http.HandleFunc.
 func (s *Session) AcceptSession() {
 	r := s.responseWriter
+	if r == nil {
+		return
+	}
 	r.WriteHeader(http.StatusOK)
 	r.Flush()
+
+	s.writeMu.Lock()
+	s.accepted = true
+	s.writeMu.Unlock()
+
+	// Ask the client to drain a session accepted after the server started
+	// draining it
+	select {
+	case <-s.drain:
+		go s.writeCapsule(h3.NewDrainCapsule())
+	default:
+	}
 }
 
 // AcceptSession rejects an incoming WebTransport session, returning the
 // supplied HTML error code to the client. Call it in your http.HandleFunc.
 func (s *Session) RejectSession(errorCode int) {
-	r := s.responseWriter
-	r.WriteHeader(errorCode)
-	r.Flush()
+	if r := s.responseWriter; r != nil {
+		r.WriteHeader(errorCode)
+		r.Flush()
+	}
 	s.CloseSession()
 }
 
 // AcceptStream accepts an incoming (that is, client-initated) bidirectional
-// stream, blocking if necessary until one is available. Supply your own
-// context, or use the WebTransport session's Context() so that ending the
-// WebTransport session automatically cancels this call.
+// stream of this WebTransport session, blocking if necessary until one is
+// available. Ending the WebTransport session automatically cancels this call.
+//
+// The WebTransport stream signal value and session ID have already been read
+// from the stream when the connection routed it to this session.
 func (s *Session) AcceptStream() (Stream, error) {
-	stream, err := s.Session.AcceptStream(s.context)
+	stream, err := s.bidiStreams.pop(s.context, s.context.Done())
 	if err != nil {
-		return stream, err
+		return Stream{}, err
 	}
-
-	streamFrame := h3.Frame{}
-	err = streamFrame.Read(stream)
-
-	return stream, err
+	s.track(stream, stream)
+	return Stream{Stream: stream, session: s}, nil
 }
 
 // AcceptUniStream accepts an incoming (that is, client-initated) unidirectional
-// stream, blocking if necessary until one is available. Supply your own context,
-// or use the WebTransport session's Context() so that ending the WebTransport
-// session automatically cancels this call.
+// stream of this WebTransport session, blocking if necessary until one is
+// available. Supply your own context, or use the WebTransport session's
+// Context() so that ending the WebTransport session automatically cancels this
+// call.
+//
+// The stream header has already been read from the stream when the connection
+// routed it to this session by the session ID in the header; streams of other
+// types are never passed to the session.
 func (s *Session) AcceptUniStream(ctx context.Context) (ReceiveStream, error) {
-	stream, err := s.Session.AcceptUniStream(ctx)
+	stream, err := s.uniStreams.pop(ctx, s.context.Done())
+	if err != nil {
+		return ReceiveStream{}, err
+	}
+	s.track(stream, nil)
 	return ReceiveStream{
-		ReceiveStream:        stream,
-		readHeaderBeforeData: true,
-		headerRead:           false,
-	}, err
+		ReceiveStream: stream,
+		sessionID:     s.StreamID(),
+		session:       s,
+	}, nil
 }
 
 // OpenStream creates an outgoing (that is, server-initiated) bidirectional
 // stream. It returns immediately.
 func (s *Session) OpenStream() (Stream, error) {
-	return s.openStream(nil, false)
+	return s.openStream(nil, false, nil)
 }
 
 // OpenStream creates an outgoing (that is, server-initiated) bidirectional
@@ -92,13 +404,23 @@ func (s *Session) OpenStream() (Stream, error) {
 // your own context, or use the WebTransport session's Context() so that ending
 // the WebTransport session automatically cancels this call.
 func (s *Session) OpenStreamSync(ctx context.Context) (Stream, error) {
-	return s.openStream(&ctx, true)
+	return s.openStream(&ctx, true, nil)
+}
+
+// OpenStreamWithOptions creates an outgoing bidirectional stream with the
+// given send group and send order, blocking as OpenStreamSync does. Only the
+// data of streams opened with options is ordered by the send scheduler of the
+// session. It returns ErrInvalidSendGroup if the send group belongs to another
+// session.
+func (s *Session) OpenStreamWithOptions(ctx context.Context,
+	opts StreamOptions) (Stream, error) {
+	return s.openStream(&ctx, true, &opts)
 }
 
 // OpenUniStream creates an outgoing (that is, server-initiated) bidirectional
 // stream. It returns immediately.
 func (s *Session) OpenUniStream() (SendStream, error) {
-	return s.openUniStream(nil, false)
+	return s.openUniStream(nil, false, nil)
 }
 
 // OpenUniStreamSync creates an outgoing (that is, server-initiated)
@@ -107,20 +429,63 @@ func (s *Session) OpenUniStream() (SendStream, error) {
 // available. Supply your own context, or use the WebTransport session's Context()
 // so that ending the WebTransport session automatically cancels this call.
 func (s *Session) OpenUniStreamSync(ctx context.Context) (SendStream, error) {
-	return s.openUniStream(&ctx, true)
+	return s.openUniStream(&ctx, true, nil)
+}
+
+// OpenUniStreamWithOptions creates an outgoing unidirectional stream with the
+// given send group and send order, blocking as OpenUniStreamSync does, as
+// OpenStreamWithOptions does for a bidirectional stream.
+func (s *Session) OpenUniStreamWithOptions(ctx context.Context,
+	opts StreamOptions) (SendStream, error) {
+	return s.openUniStream(&ctx, true, &opts)
 }
 
 // CloseSession cleanly closes a WebTransport session. All active streams are
-// cancelled before terminating the session.
+// reset with the WEBTRANSPORT_SESSION_GONE error code before the request
+// stream is closed.
 func (s *Session) CloseSession() {
-	s.cancel()
+	s.end(&SessionError{Cause: CloseCauseCapsule})
 	s.Close()
 }
 
-// CloseWithError closes a WebTransport session with a supplied error code and
-// string.
-func (s *Session) CloseWithError(code quic.ApplicationErrorCode, str string) {
-	s.Session.CloseWithError(code, str)
+// CloseWithError closes a WebTransport session with a supplied application
+// error code and message. It sends a CLOSE_WEBTRANSPORT_SESSION capsule to the
+// peer, resets the streams of the session and closes the request stream. The
+// QUIC connection and the other sessions on it are not affected.
+//
+// On the server side the session must have been accepted, otherwise
+// ErrSessionNotAccepted is returned; use RejectSession instead.
+func (s *Session) CloseWithError(code SessionErrorCode, msg string) error {
+	s.writeMu.Lock()
+	accepted := s.accepted
+	s.writeMu.Unlock()
+	if !accepted {
+		return ErrSessionNotAccepted
+	}
+
+	return s.closeSession(&SessionError{
+		ErrorCode: code,
+		Message:   msg,
+		Cause:     CloseCauseCapsule,
+	})
+}
+
+// closeSession ends the session with the given error, which resets its
+// streams, and sends a CLOSE_WEBTRANSPORT_SESSION capsule with the error code
+// and message of the error before closing the request stream.
+func (s *Session) closeSession(e *SessionError) error {
+	s.end(e)
+	err := s.writeCapsule(h3.NewCloseCapsule(uint32(e.ErrorCode), e.Message))
+	if closeErr := s.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// CloseConnection closes the QUIC connection of a WebTransport session with a
+// supplied error code and string. All sessions on the connection end.
+func (s *Session) CloseConnection(code quic.ApplicationErrorCode, str string) error {
+	return s.Session.CloseWithError(code, str)
 }
 
 // openStream creates an outgoing (that is, server-initiated) bidirectional
@@ -130,44 +495,251 @@ func (s *Session) CloseWithError(code quic.ApplicationErrorCode, str string) {
 //   - one byte with the frame type (should be h3.FRAME_WEBTRANSPORT_STREAM)
 //   - requestSessionID, which is the ID of the stream, as it is sent in the
 //     WebTransport stream header.
-func (s *Session) openStream(ctx *context.Context, sync bool) (Stream, error) {
+func (s *Session) openStream(ctx *context.Context, sync bool,
+	opts *StreamOptions) (Stream, error) {
+
 	var stream quic.Stream
 	var err error
 
+	priority, err := s.newSendPriority(opts)
+	if err != nil {
+		return Stream{}, err
+	}
+
+	// Apply the stream limit of the peer
+	reserveCtx := s.context
+	if ctx != nil {
+		reserveCtx = *ctx
+	}
+	if err := s.reserveStream(reserveCtx, true, sync); err != nil {
+		return Stream{}, err
+	}
+
 	if sync {
 		stream, err = s.Session.OpenStreamSync(*ctx)
 	} else {
 		stream, err = s.Session.OpenStream()
 	}
+	if err != nil {
+		s.unreserveStream(true)
+		return Stream{}, err
+	}
 
-	if err == nil {
-		// Write frame header
-		buf := &bytes.Buffer{}
-		buf.Write(quicvarint.Append(nil, h3.FRAME_WEBTRANSPORT_STREAM))
-		buf.Write(quicvarint.Append(nil, uint64(s.StreamID())))
-		if _, err := stream.Write(buf.Bytes()); err != nil {
-			stream.Close()
-		}
+	// Write frame header
+	buf := &bytes.Buffer{}
+	buf.Write(quicvarint.Append(nil, h3.FRAME_WEBTRANSPORT_STREAM))
+	buf.Write(quicvarint.Append(nil, uint64(s.StreamID())))
+	if _, err := stream.Write(buf.Bytes()); err != nil {
+		stream.CancelRead(h3.H3_REQUEST_CANCELLED)
+		stream.CancelWrite(h3.H3_REQUEST_CANCELLED)
+		return Stream{}, err
 	}
+	stream = s.bufferStream(stream)
+	s.track(stream, stream)
 
-	return stream, err
+	return Stream{Stream: stream, session: s, priority: priority}, nil
 }
 
 // openUniStream creates an outgoing (that is, server-initiated) unidirectional
 // stream. It returns immediately.
-func (s *Session) openUniStream(ctx *context.Context, sync bool) (SendStream, error) {
+func (s *Session) openUniStream(ctx *context.Context, sync bool,
+	opts *StreamOptions) (SendStream, error) {
+
 	var stream quic.SendStream
 	var err error
 
+	priority, err := s.newSendPriority(opts)
+	if err != nil {
+		return SendStream{}, err
+	}
+
+	// Apply the stream limit of the peer
+	reserveCtx := s.context
+	if ctx != nil {
+		reserveCtx = *ctx
+	}
+	if err := s.reserveStream(reserveCtx, false, sync); err != nil {
+		return SendStream{}, err
+	}
+
 	if sync {
 		stream, err = s.Session.OpenUniStreamSync(*ctx)
 	} else {
 		stream, err = s.Session.OpenUniStream()
 	}
+	if err != nil {
+		s.unreserveStream(false)
+		return SendStream{}, err
+	}
+	s.track(nil, stream)
+
 	return SendStream{
 		SendStream:            stream,
 		writeHeaderBeforeData: true,
 		headerWritten:         false,
 		requestSessionID:      uint64(s.StreamID()),
-	}, err
+		session:               s,
+		priority:              priority,
+	}, nil
+}
+
+// trackedStream is a stream of a WebTransport session which is reset when the
+// session is closed. Either or both of recv and send are set.
+type trackedStream struct {
+	recv quic.ReceiveStream
+	send quic.SendStream
+}
+
+// reset resets the stream with the WEBTRANSPORT_SESSION_GONE error code.
+func (t trackedStream) reset() {
+	if t.recv != nil {
+		t.recv.CancelRead(h3.WEBTRANSPORT_SESSION_GONE)
+	}
+	if t.send != nil {
+		t.send.CancelWrite(h3.WEBTRANSPORT_SESSION_GONE)
+	}
+}
+
+// track registers a stream opened or accepted by the session. A stream with a
+// send direction is unregistered when its send direction is closed, a receive
+// stream when it has been read to the end. Streams registered after the
+// session was closed are reset right away.
+func (s *Session) track(recv quic.ReceiveStream, send quic.SendStream) {
+	s.touch()
+	t := trackedStream{recv: recv, send: send}
+	var id quic.StreamID
+	if send != nil {
+		id = send.StreamID()
+	} else {
+		id = recv.StreamID()
+	}
+
+	s.mu.Lock()
+	if s.reset {
+		s.mu.Unlock()
+		t.reset()
+		return
+	}
+	if s.streams == nil {
+		s.streams = make(map[quic.StreamID]trackedStream)
+	}
+	s.streams[id] = t
+	s.mu.Unlock()
+
+	if send != nil {
+		context.AfterFunc(send.Context(), func() { s.untrack(id) })
+	}
+}
+
+// untrack unregisters a stream of the session.
+func (s *Session) untrack(id quic.StreamID) {
+	s.mu.Lock()
+	_, ok := s.streams[id]
+	delete(s.streams, id)
+	s.mu.Unlock()
+
+	if ok {
+		s.streamClosed(id)
+	}
+}
+
+// pushStream passes a stream opened by the peer to the accept queue of the
+// session. The stream is reset if the session is closed, the accept queue is
+// full or the peer exceeded the stream limit of the session.
+func (s *Session) pushStream(p pendingStream) {
+	if !s.incomingStream(p.bidi != nil) {
+		p.reset(h3.WEBTRANSPORT_SESSION_GONE)
+		return
+	}
+
+	// The data of the stream is counted against the data limit of the
+	// session from now on, even while the stream waits to be accepted
+	var err error
+	if p.bidi != nil {
+		err = s.bidiStreams.push(s.bufferStream(p.bidi))
+	} else {
+		err = s.uniStreams.push(s.bufferReceiveStream(p.uni))
+	}
+	switch err {
+	case errQueueClosed:
+		p.reset(h3.WEBTRANSPORT_SESSION_GONE)
+	case errQueueFull:
+		// The rejected stream does not count against the stream limit
+		p.reset(h3.WEBTRANSPORT_BUFFERED_STREAM_REJECTED)
+		s.streamClosed(p.streamID())
+	}
+}
+
+// PendingStreams returns the number of incoming bidirectional and
+// unidirectional streams waiting in the accept queues of the session.
+func (s *Session) PendingStreams() (bidi, uni int) {
+	return s.bidiStreams.len(), s.uniStreams.len()
+}
+
+// writeData writes data to a stream of the session, applying the data limit of
+// the peer. The data is written in chunks; if the stream has a priority, each
+// chunk is written when the send scheduler of the session gives the stream its
+// turn. Waiting for the turn or the data limit stops when the context is done.
+func (s *Session) writeData(ctx context.Context, str quic.SendStream,
+	priority *sendPriority, p []byte) (int, error) {
+
+	var written int
+	for len(p) > 0 {
+		if priority != nil {
+			err := s.scheduler.acquire(ctx, s.context.Done(), priority)
+			if err != nil {
+				return written, err
+			}
+		}
+		n, err := s.reserveData(ctx, min(len(p), sendChunkSize))
+		if err != nil {
+			if priority != nil {
+				s.scheduler.release()
+			}
+			return written, err
+		}
+		s.touch()
+		if priority != nil {
+			n, err = s.scheduler.write(str, p[:n])
+		} else {
+			n, err = str.Write(p[:n])
+		}
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// ActiveStreams returns the number of streams opened or accepted by the
+// session which are still active. A stream stops being active when its send
+// direction is closed or reset, or, for a receive stream, when it has been read
+// to the end or reset. All active streams are reset with the
+// WEBTRANSPORT_SESSION_GONE error code when the session ends.
+func (s *Session) ActiveStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// resetStreams resets all registered streams of the session and the streams
+// waiting in its accept queues.
+func (s *Session) resetStreams() {
+	s.mu.Lock()
+	streams := s.streams
+	s.streams = nil
+	s.reset = true
+	s.mu.Unlock()
+
+	for _, t := range streams {
+		t.reset()
+	}
+	for _, str := range s.bidiStreams.close() {
+		trackedStream{recv: str, send: str}.reset()
+	}
+	for _, str := range s.uniStreams.close() {
+		trackedStream{recv: str}.reset()
+	}
 }
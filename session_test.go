@@ -0,0 +1,379 @@
+package webtransport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// failingStream is a quic.Stream whose writes fail. Only StreamID, Write,
+// CancelRead and CancelWrite may be called.
+type failingStream struct {
+	quic.Stream
+	id                          quic.StreamID
+	readCanceled, writeCanceled bool
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (s *failingStream) StreamID() quic.StreamID          { return s.id }
+func (s *failingStream) Write([]byte) (int, error)        { return 0, errWriteFailed }
+func (s *failingStream) CancelRead(quic.StreamErrorCode)  { s.readCanceled = true }
+func (s *failingStream) CancelWrite(quic.StreamErrorCode) { s.writeCanceled = true }
+
+// streamConn is a quic.Connection opening the stream. Only OpenStream may be
+// called.
+type streamConn struct {
+	quic.Connection
+	stream quic.Stream
+}
+
+func (c *streamConn) OpenStream() (quic.Stream, error) { return c.stream, nil }
+
+func TestOpenStreamHeaderWriteFails(t *testing.T) {
+	str := &failingStream{id: 4}
+	s := &Session{
+		Stream:  &failingStream{id: 0},
+		Session: &streamConn{stream: str},
+		context: context.Background(),
+	}
+	s.initFlowControl()
+
+	if _, err := s.OpenStream(); err != errWriteFailed {
+		t.Fatalf("got %v, want the write error", err)
+	}
+	if !str.readCanceled || !str.writeCanceled {
+		t.Fatal("the stream was not reset")
+	}
+	if n := s.ActiveStreams(); n != 0 {
+		t.Fatalf("%d active streams, want 0", n)
+	}
+}
+
+func TestOpenStreamTracked(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	bidi, err := server.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.OpenUniStream(); err != nil {
+		t.Fatal(err)
+	}
+	if n := server.ActiveStreams(); n != 2 {
+		t.Fatalf("%d active streams, want 2", n)
+	}
+
+	// Closing the session resets the streams and stops tracking them
+	client.CloseSession()
+	select {
+	case <-bidi.Context().Done():
+	case <-testContext(t).Done():
+		t.Fatal("the stream was not reset")
+	}
+	if _, err := bidi.Write([]byte("data")); err == nil {
+		t.Fatal("wrote to a stream of a closed session")
+	}
+	waitFor(t, "the streams to be untracked", func() bool {
+		return server.ActiveStreams() == 0
+	})
+}
+
+// sessionError waits until the session ends and returns its error.
+func sessionError(t *testing.T, s *Session) *SessionError {
+	t.Helper()
+	select {
+	case <-s.Context().Done():
+	case <-testContext(t).Done():
+		t.Fatal("the session did not end")
+	}
+	var sessionErr *SessionError
+	if !errors.As(s.Err(), &sessionErr) {
+		t.Fatalf("session ended with %v", s.Err())
+	}
+	return sessionErr
+}
+
+func TestCloseCapsuleReceived(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	if err := client.CloseWithError(7, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	e := sessionError(t, server)
+	if e.ErrorCode != 7 || e.Message != "bye" || !e.Remote ||
+		e.Cause != CloseCauseCapsule {
+		t.Fatalf("got %+v", e)
+	}
+}
+
+func TestCloseWithErrorKeepsConnection(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	c := dialConn(t, url, nil)
+	client1 := connectSession(t, c, url+"/one")
+	server1 := acceptedSession(t, sessions)
+	client2 := connectSession(t, c, url+"/two")
+	server2 := acceptedSession(t, sessions)
+
+	str, err := client1.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := str.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server1.AcceptStream(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing the first session resets its streams only
+	if err := server1.CloseWithError(5, "gone"); err != nil {
+		t.Fatal(err)
+	}
+	if e := sessionError(t, client1); e.ErrorCode != 5 || !e.Remote {
+		t.Fatalf("got %+v", e)
+	}
+	var quicErr *quic.StreamError
+	if _, err := str.Read(make([]byte, 1)); !errors.As(err, &quicErr) ||
+		quicErr.ErrorCode != h3.WEBTRANSPORT_SESSION_GONE {
+		t.Fatalf("the stream of the closed session read %v", err)
+	}
+
+	// The connection and the second session are still usable
+	if c.Context().Err() != nil {
+		t.Fatal("the connection was closed")
+	}
+	str, err = client2.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := str.Write([]byte("y")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server2.AcceptStream(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCloseConnection(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	c := dialConn(t, url, nil)
+	client1 := connectSession(t, c, url+"/one")
+	server1 := acceptedSession(t, sessions)
+	connectSession(t, c, url+"/two")
+	server2 := acceptedSession(t, sessions)
+
+	// Closing the connection ends every session on it
+	if err := client1.CloseConnection(9, "shutdown"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*Session{server1, server2} {
+		e := sessionError(t, s)
+		var appErr *quic.ApplicationError
+		if e.Cause != CloseCauseConnection || !e.Remote ||
+			!errors.As(e, &appErr) || appErr.ErrorCode != 9 {
+			t.Fatalf("got %+v", e)
+		}
+	}
+}
+
+func TestCloseWithErrorNotAccepted(t *testing.T) {
+	s := &Server{}
+	closed := make(chan error, 1)
+	s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := r.Body.(*Session)
+		closed <- session.CloseWithError(1, "")
+		session.RejectSession(http.StatusForbidden)
+	})
+	url := startServer(t, s)
+	testDialer().Dial(testContext(t), url+"/wt", nil)
+	if err := <-closed; err != ErrSessionNotAccepted {
+		t.Fatalf("got %v, want ErrSessionNotAccepted", err)
+	}
+}
+
+func TestSessionErrCause(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+	if err := server.Err(); err != nil {
+		t.Fatalf("got %v for an active session", err)
+	}
+
+	// The local side sees its own close, and the context carries it as cause
+	if err := server.CloseWithError(2, "local"); err != nil {
+		t.Fatal(err)
+	}
+	e := sessionError(t, server)
+	if e.Remote || e.ErrorCode != 2 || e.Cause != CloseCauseCapsule {
+		t.Fatalf("got %+v", e)
+	}
+	if cause := context.Cause(server.Context()); cause != server.Err() {
+		t.Fatalf("got context cause %v, want %v", cause, server.Err())
+	}
+	if e := sessionError(t, client); !e.Remote {
+		t.Fatalf("got %+v", e)
+	}
+}
+
+func TestSessionErrStreamReset(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	// Resetting the request stream ends the session without a capsule
+	client.Stream.CancelWrite(h3.H3_REQUEST_CANCELLED)
+	e := sessionError(t, server)
+	var streamErr *quic.StreamError
+	if e.Cause != CloseCauseStreamReset || !e.Remote ||
+		!errors.As(e, &streamErr) || streamErr.ErrorCode != h3.H3_REQUEST_CANCELLED {
+		t.Fatalf("got %+v", e)
+	}
+}
+
+func TestAcceptedStreamsReset(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	bidi, err := client.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uni, err := client.OpenUniStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []io.Writer{bidi, &uni} {
+		if _, err := w.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := server.AcceptStream(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.AcceptUniStream(testContext(t)); err != nil {
+		t.Fatal(err)
+	}
+	if n := server.ActiveStreams(); n != 2 {
+		t.Fatalf("%d active streams, want 2", n)
+	}
+
+	// The peer sees the accepted streams reset with the session gone code
+	server.CloseSession()
+	var streamErr *quic.StreamError
+	if _, err := bidi.Read(make([]byte, 1)); !errors.As(err, &streamErr) ||
+		streamErr.ErrorCode != h3.WEBTRANSPORT_SESSION_GONE {
+		t.Fatalf("got %v, want a reset with WEBTRANSPORT_SESSION_GONE", err)
+	}
+	select {
+	case <-uni.Context().Done():
+	case <-testContext(t).Done():
+		t.Fatal("the unidirectional stream was not stopped")
+	}
+}
+
+func TestActiveStreamsUntracked(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	uni, err := client.OpenUniStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := uni.Close(); err != nil {
+		t.Fatal(err)
+	}
+	accepted, err := server.AcceptUniStream(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := server.ActiveStreams(); n != 1 {
+		t.Fatalf("%d active streams, want 1", n)
+	}
+
+	// A stream read to the end is no longer active
+	if _, err := io.ReadAll(&accepted); err != nil {
+		t.Fatal(err)
+	}
+	if n := server.ActiveStreams(); n != 0 {
+		t.Fatalf("%d active streams, want 0", n)
+	}
+	waitFor(t, "the closed stream to be untracked", func() bool {
+		return client.ActiveStreams() == 0
+	})
+}
+
+func TestMalformedCapsule(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	// A DRAIN_WEBTRANSPORT_SESSION capsule must be empty
+	capsule := quicvarint.Append(nil, h3.CAPSULE_DRAIN_WEBTRANSPORT_SESSION)
+	capsule = quicvarint.Append(capsule, 1)
+	capsule = append(capsule, 0)
+	if _, err := client.Stream.Write(frame(h3.FRAME_DATA, capsule)); err != nil {
+		t.Fatal(err)
+	}
+
+	e := sessionError(t, server)
+	if e.Cause != CloseCauseStreamReset || e.Remote ||
+		!errors.Is(e, h3.ErrCapsuleMalformed) {
+		t.Fatalf("got %+v", e)
+	}
+
+	// The peer sees the request stream reset with H3_MESSAGE_ERROR
+	e = sessionError(t, client)
+	var streamErr *quic.StreamError
+	if e.Cause != CloseCauseStreamReset || !e.Remote ||
+		!errors.As(e, &streamErr) || streamErr.ErrorCode != h3.H3_MESSAGE_ERROR {
+		t.Fatalf("got %+v", e)
+	}
+}
+
+// afterFuncContext is a context which is never done, counting the functions
+// registered with context.AfterFunc which were not unregistered.
+type afterFuncContext struct {
+	context.Context
+	done       chan struct{}
+	registered atomic.Int32
+}
+
+func (c *afterFuncContext) Done() <-chan struct{} { return c.done }
+
+func (c *afterFuncContext) AfterFunc(f func()) func() bool {
+	c.registered.Add(1)
+	return func() bool {
+		c.registered.Add(-1)
+		return true
+	}
+}
+
+func TestSessionEndUnregisters(t *testing.T) {
+	url := startServer(t, &Server{})
+	c := dialConn(t, url, nil)
+	str, err := c.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := &afterFuncContext{
+		Context: context.Background(),
+		done:    make(chan struct{}),
+	}
+	s := newSession(c, str, Draft07, parent)
+	if n := parent.registered.Load(); n != 1 {
+		t.Fatalf("%d functions registered on the connection context, want 1", n)
+	}
+
+	// The ended session is not referenced by the connection context
+	s.CloseSession()
+	if n := parent.registered.Load(); n != 0 {
+		t.Fatalf("%d functions still registered after the session ended", n)
+	}
+}
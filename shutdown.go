@@ -0,0 +1,173 @@
+// Copyright 2025 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Shutdown module of webtransport package.
+
+package webtransport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// ErrServerClosed is returned by the Server's Run, Serve, ServeTransport and
+// ServeListener methods after a call to Shutdown.
+var ErrServerClosed = fmt.Errorf("webtransport server closed")
+
+// shutdownPollInterval is how often Shutdown checks for active handlers.
+const shutdownPollInterval = 100 * time.Millisecond
+
+// serverListener is a QUIC listener of the Server together with the transport
+// and packet connection the Server has to close when it stops. The transport
+// and packet connection are nil if they are owned by the caller.
+type serverListener struct {
+	*quic.Listener
+	transport  *quic.Transport
+	packetConn net.PacketConn
+}
+
+// close closes the listener, its transport and its packet connection.
+func (l *serverListener) close() {
+	l.Listener.Close()
+	if l.transport != nil {
+		l.transport.Close()
+	}
+	if l.packetConn != nil {
+		l.packetConn.Close()
+	}
+}
+
+// Shutdown gracefully shuts down the server. It stops accepting new
+// connections, sends an HTTP/3 GOAWAY frame on the control stream of every
+// connection so that clients open no new WebTransport sessions, and tells all
+// active sessions to drain (see Session.Draining). It then waits for the
+// active handlers to return and closes the connections.
+//
+// If the supplied context expires before all handlers have returned, Shutdown
+// closes the connections anyway and returns the context's error.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.inShutdown = true
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	for l := range s.listeners {
+		l.Listener.Close()
+	}
+	s.mu.Unlock()
+
+	// Tell clients to go away and sessions to drain
+	for _, c := range conns {
+		c.goAway()
+	}
+
+	// Wait for active handlers to finish
+	err := s.waitHandlers(ctx)
+
+	s.close()
+	return err
+}
+
+// waitHandlers waits until there are no active handlers or the context is
+// done.
+func (s *Server) waitHandlers(ctx context.Context) error {
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		s.mu.Lock()
+		active := s.activeHandlers
+		s.mu.Unlock()
+		if active == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// close immediately closes all connections and listeners of the server.
+func (s *Server) close() {
+	s.mu.Lock()
+	s.inShutdown = true
+	conns := s.conns
+	listeners := s.listeners
+	s.conns = nil
+	s.listeners = nil
+	s.mu.Unlock()
+
+	for c := range conns {
+		c.CloseWithError(h3.H3_NO_ERROR, "server closed")
+	}
+	for l := range listeners {
+		l.close()
+	}
+}
+
+// shuttingDown reports whether the server is shutting down.
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inShutdown
+}
+
+// trackListener registers a listener of the server. It returns false if the
+// server is shutting down.
+func (s *Server) trackListener(l *serverListener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inShutdown {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[*serverListener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+// trackConn registers a connection of the server. It returns false if the
+// server is shutting down.
+func (s *Server) trackConn(c *conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inShutdown {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[*conn]struct{})
+	}
+	s.conns[c] = struct{}{}
+	return true
+}
+
+// untrackConn unregisters a connection of the server.
+func (s *Server) untrackConn(c *conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+}
+
+// handlerStarted counts a handler which started serving a request.
+func (s *Server) handlerStarted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activeHandlers++
+}
+
+// handlerDone counts a handler which finished serving a request.
+func (s *Server) handlerDone() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activeHandlers--
+}
@@ -0,0 +1,98 @@
+package webtransport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+func TestShutdownDrainsSessions(t *testing.T) {
+	s := &Server{}
+	url, sessions := startSessionServer(t, s)
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(testContext(t)) }()
+
+	// Both sides are told to drain, the client by the GOAWAY frame
+	for _, session := range []*Session{client, server} {
+		select {
+		case <-session.Draining():
+		case <-time.After(testTimeout):
+			t.Fatal("the session is not draining")
+		}
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v with an active session", err)
+	default:
+	}
+
+	// Shutdown returns when the handler of the session returned
+	client.CloseSession()
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Shutdown did not return")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	s := &Server{}
+	url, sessions := startSessionServer(t, s)
+	client, _ := dialSession(t, nil, url+"/wt", sessions)
+
+	// The handler does not return, so the connections are closed when the
+	// context expires
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	select {
+	case <-client.Context().Done():
+	case <-testContext(t).Done():
+		t.Fatal("the session did not end")
+	}
+}
+
+func TestShutdownRejectsRequests(t *testing.T) {
+	s := &Server{}
+	urlStr, sessions := startSessionServer(t, s)
+	c := dialConn(t, urlStr, nil)
+	client := connectSession(t, c, urlStr+"/wt")
+	acceptedSession(t, sessions)
+
+	go s.Shutdown(testContext(t))
+	select {
+	case <-client.Draining():
+	case <-testContext(t).Done():
+		t.Fatal("no GOAWAY received")
+	}
+
+	// A request sent after the GOAWAY frame is rejected
+	str, err := c.OpenStreamSync(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(urlStr + "/wt")
+	req := &http.Request{Method: http.MethodConnect, URL: u,
+		Header: http.Header{}, Host: u.Host}
+	if err := h3.WriteRequestHeaders(str, req, "webtransport"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = str.Read(make([]byte, 1))
+	var streamErr *quic.StreamError
+	if !errors.As(err, &streamErr) || streamErr.ErrorCode != h3.H3_REQUEST_REJECTED {
+		t.Fatalf("got %v, want a reset with H3_REQUEST_REJECTED", err)
+	}
+}
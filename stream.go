@@ -8,6 +8,7 @@ package webtransport
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 
 	"github.com/quic-go/quic-go"
@@ -15,19 +16,136 @@ import (
 	"github.com/teonet-go/webtransport-go/h3"
 )
 
+// ErrWrongStreamType was returned by ReceiveStream.Read for a unidirectional
+// stream of the wrong stream type.
+//
+// Deprecated: the stream header is parsed when the stream is received, and
+// streams which are not WebTransport streams never reach the session.
 var ErrWrongStreamType = fmt.Errorf("unidirectional stream received with the wrong stream type")
 
-// Stream wraps a quic.Stream providing a bidirectional client server stream,
-// including Read and Write functions.
-type Stream quic.Stream
+// Stream is a bidirectional stream of a WebTransport session, wrapping a
+// quic.Stream. It applies the flow control of the session to the data read
+// and written.
+//
+// CancelRead and CancelWrite take WebTransport application error codes, and
+// Read and Write return a *StreamError when the peer resets the stream with
+// one. Because of the different cancel methods a Stream is not a quic.Stream,
+// use the embedded quic.Stream where one is needed.
+//
+// Streams are created by Session.OpenStream and Session.AcceptStream, which
+// return the zero Stream on error. The zero Stream has no QUIC stream: Read,
+// Write and Close return ErrSTreamClosed and the cancel methods do nothing.
+type Stream struct {
+	quic.Stream
+	session  *Session
+	priority *sendPriority
+}
+
+// Read reads up to len(p) bytes from the stream.
+func (s Stream) Read(p []byte) (int, error) {
+	if s.Stream == nil {
+		return 0, ErrSTreamClosed
+	}
+	n, err := s.Stream.Read(p)
+	if n > 0 {
+		s.session.touch()
+	}
+	return n, streamError(err)
+}
+
+// Write writes len(p) bytes to the stream, blocking while the flow control
+// limit of the peer is reached.
+func (s Stream) Write(p []byte) (int, error) {
+	if s.Stream == nil {
+		return 0, ErrSTreamClosed
+	}
+	return s.write(s.Stream.Context(), p)
+}
+
+// write writes len(p) bytes to the stream. Waiting for the flow control limit
+// of the peer stops when the context is done.
+func (s Stream) write(ctx context.Context, p []byte) (int, error) {
+	n, err := s.session.writeData(ctx, s.Stream, s.priority, p)
+	return n, streamError(err)
+}
+
+// Close closes the send direction of the stream, as SendStream.Close does.
+// The receive direction is not affected; use CancelRead to stop receiving, as
+// ReceiveStream.Close does.
+func (s Stream) Close() error {
+	if s.Stream == nil {
+		return ErrSTreamClosed
+	}
+	return streamError(s.Stream.Close())
+}
+
+// CancelRead aborts receiving on the stream, asking the peer to stop sending
+// with the WebTransport application error code.
+func (s Stream) CancelRead(code StreamErrorCode) {
+	if s.Stream == nil {
+		return
+	}
+	s.Stream.CancelRead(webtransportCodeToHTTPCode(code))
+}
+
+// CancelWrite aborts sending on the stream, resetting it with the
+// WebTransport application error code.
+func (s Stream) CancelWrite(code StreamErrorCode) {
+	if s.Stream == nil {
+		return
+	}
+	s.Stream.CancelWrite(webtransportCodeToHTTPCode(code))
+}
+
+// SessionID returns the ID of the WebTransport session the stream belongs to,
+// which is the stream ID of the session's request stream, or 0 for the zero
+// Stream.
+func (s Stream) SessionID() quic.StreamID {
+	if s.session == nil {
+		return 0
+	}
+	return s.session.StreamID()
+}
+
+// Session returns the WebTransport session the stream belongs to, or nil for
+// the zero Stream.
+func (s Stream) Session() *Session {
+	return s.session
+}
+
+// SendGroup returns the send group of the stream, or nil if the stream
+// belongs to the default group of its session or is not scheduled.
+func (s Stream) SendGroup() *SendGroup {
+	if s.priority == nil {
+		return nil
+	}
+	return s.priority.group
+}
+
+// SendOrder returns the send order of the stream within its send group.
+func (s Stream) SendOrder() int64 {
+	if s.priority == nil {
+		return 0
+	}
+	return s.priority.order.Load()
+}
+
+// SetSendOrder changes the send order of the stream within its send group.
+// Data of streams with a higher send order is sent first. It has no effect on
+// a stream opened without StreamOptions, which is not scheduled.
+func (s Stream) SetSendOrder(order int64) {
+	if s.priority != nil {
+		s.priority.order.Store(order)
+	}
+}
 
 // ReceiveStream wraps a quic.ReceiveStream providing a unidirectional
-// WebTransport client server stream, including a Read function.
+// WebTransport client server stream, including a Read function. The stream
+// header has already been read when the stream is accepted.
 type ReceiveStream struct {
 	quic.ReceiveStream
-	readHeaderBeforeData bool
-	headerRead           bool
-	requestSessionID     uint64
+	sessionID quic.StreamID // session ID from the stream header
+	session   *Session      // unregisters the stream when it ends
 }
 
 // SendStream wraps a quic.SendStream providing a unidirectional WebTransport
@@ -37,34 +155,46 @@ type SendStream struct {
 	writeHeaderBeforeData bool
 	headerWritten         bool
 	requestSessionID      uint64
+	session               *Session // applies the session flow control
+	priority              *sendPriority
 }
 
 // Read reads up to len(p) bytes from a WebTransport unidirectional stream,
 // and return the actual number of bytes read or an error.
-//
-// Before first read it reads stream header and checks that the stream type is
-// correct (it should be h3.STREAM_WEBTRANSPORT_UNI_STREAM). If the stream type
-// is wrong, it returns ErrWrongStreamType. After reading the stream header it
-// stores the requestSessionID field and marks the header as read.
 func (s *ReceiveStream) Read(p []byte) (int, error) {
-
-	// Read stream header before first data read
-	if s.readHeaderBeforeData && !s.headerRead {
-		streamHeader := h3.StreamHeader{}
-		if err := streamHeader.Read(s.ReceiveStream); err != nil {
-			return 0, err
+	n, err := s.ReceiveStream.Read(p)
+	if s.session != nil {
+		if n > 0 {
+			s.session.touch()
 		}
-		if streamHeader.Type != h3.STREAM_WEBTRANSPORT_UNI_STREAM {
-			return 0, ErrWrongStreamType
+		if err != nil {
+			s.session.untrack(s.StreamID())
 		}
-		// Store the requestSessionID from the stream header
-		s.requestSessionID = streamHeader.ID
-		// Mark the header as read
-		s.headerRead = true
 	}
+	return n, streamError(err)
+}
 
-	// Read data
-	return s.ReceiveStream.Read(p)
+// SessionID returns the ID of the WebTransport session the stream belongs to,
+// as read from the stream header.
+func (s *ReceiveStream) SessionID() quic.StreamID {
+	return s.sessionID
+}
+
+// CancelRead aborts receiving on the stream, asking the peer to stop sending
+// with the WebTransport application error code.
+func (s *ReceiveStream) CancelRead(code StreamErrorCode) {
+	s.ReceiveStream.CancelRead(webtransportCodeToHTTPCode(code))
+}
+
+// Close stops receiving on the stream. The peer is asked to stop sending with
+// the WebTransport application error code 0, which has no effect if the stream
+// was read to the end.
+func (s *ReceiveStream) Close() error {
+	s.CancelRead(0)
+	if s.session != nil {
+		s.session.untrack(s.StreamID())
+	}
+	return nil
 }
 
 // Write writes up to len(p) bytes to a WebTransport unidirectional stream,
@@ -86,13 +216,65 @@ func (s *SendStream) Write(p []byte) (int, error) {
 		// Write the buffer to the stream
 		if _, err := s.SendStream.Write(buf.Bytes()); err != nil {
 			// Close the stream if there is an error
-			s.Close()
-			return 0, err
+			s.SendStream.Close()
+			return 0, streamError(err)
 		}
 		// Mark the header as written
 		s.headerWritten = true
 	}
 
 	// Write data
-	return s.SendStream.Write(p)
+	var n int
+	var err error
+	if s.session != nil {
+		n, err = s.session.writeData(s.SendStream.Context(), s.SendStream,
+			s.priority, p)
+	} else {
+		n, err = s.SendStream.Write(p)
+	}
+	return n, streamError(err)
+}
+
+// Close closes the stream after the data written to it was sent. The stream
+// header is sent first if nothing was written to the stream yet, so that the
+// peer can associate the stream with its session.
+func (s *SendStream) Close() error {
+	if s.writeHeaderBeforeData && !s.headerWritten {
+		if _, err := s.Write(nil); err != nil {
+			return err
+		}
+	}
+	return streamError(s.SendStream.Close())
+}
+
+// SendGroup returns the send group of the stream, or nil if the stream
+// belongs to the default group of its session or is not scheduled.
+func (s *SendStream) SendGroup() *SendGroup {
+	if s.priority == nil {
+		return nil
+	}
+	return s.priority.group
+}
+
+// SendOrder returns the send order of the stream within its send group.
+func (s *SendStream) SendOrder() int64 {
+	if s.priority == nil {
+		return 0
+	}
+	return s.priority.order.Load()
+}
+
+// SetSendOrder changes the send order of the stream within its send group.
+// Data of streams with a higher send order is sent first. It has no effect on
+// a stream opened without StreamOptions, which is not scheduled.
+func (s *SendStream) SetSendOrder(order int64) {
+	if s.priority != nil {
+		s.priority.order.Store(order)
+	}
+}
+
+// CancelWrite aborts sending on the stream, resetting it with the
+// WebTransport application error code.
+func (s *SendStream) CancelWrite(code StreamErrorCode) {
+	s.SendStream.CancelWrite(webtransportCodeToHTTPCode(code))
 }
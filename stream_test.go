@@ -0,0 +1,121 @@
+package webtransport
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+func TestStreamSession(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	str, err := client.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := str.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	str.Close()
+
+	accepted, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accepted.Session() != server || str.Session() != client {
+		t.Fatal("the streams do not carry their sessions")
+	}
+	if accepted.SessionID() != server.StreamID() {
+		t.Fatalf("got session ID %d, want %d", accepted.SessionID(),
+			server.StreamID())
+	}
+	data, err := io.ReadAll(accepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("got %q, want %q", data, "hello")
+	}
+}
+
+func TestOpenStreamClosedSession(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	client, _ := dialSession(t, nil, url+"/wt", sessions)
+
+	client.CloseConnection(0, "")
+	str, err := client.OpenStream()
+	if err == nil || str != (Stream{}) {
+		t.Fatalf("got %v, %v, want the zero stream and an error", str, err)
+	}
+
+	// The zero stream is safe to use
+	if _, err := str.Write([]byte("hello")); err != ErrSTreamClosed {
+		t.Fatalf("got %v, want %v", err, ErrSTreamClosed)
+	}
+	if _, err := str.Read(make([]byte, 1)); err != ErrSTreamClosed {
+		t.Fatalf("got %v, want %v", err, ErrSTreamClosed)
+	}
+	if err := str.Close(); err != ErrSTreamClosed {
+		t.Fatalf("got %v, want %v", err, ErrSTreamClosed)
+	}
+	str.CancelRead(0)
+	str.CancelWrite(0)
+	if str.Session() != nil || str.SessionID() != 0 {
+		t.Fatal("the zero stream carries a session")
+	}
+}
+
+func TestReceiveStreamHeader(t *testing.T) {
+	url, sessions := startSessionServer(t, &Server{})
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	str, err := client.OpenUniStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := str.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	str.Close()
+
+	// The header was read when the stream was accepted
+	accepted, err := server.AcceptUniStream(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accepted.SessionID() != server.StreamID() {
+		t.Fatalf("got session ID %d, want %d", accepted.SessionID(),
+			server.StreamID())
+	}
+	data, err := io.ReadAll(&accepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("got %q, want %q", data, "hello")
+	}
+}
+
+func TestReceiveStreamUnknownSession(t *testing.T) {
+	url := startServer(t, &Server{})
+	qconn := dialQUIC(t, url)
+
+	// A stream of a session ID which is not a session is stopped
+	str := uniStream(t, qconn, h3.STREAM_WEBTRANSPORT_UNI_STREAM,
+		quicvarint.Append(nil, 2))
+	select {
+	case <-str.Context().Done():
+	case <-testContext(t).Done():
+		t.Fatal("the stream was not stopped")
+	}
+	_, err := str.Write([]byte("x"))
+	var streamErr *quic.StreamError
+	if !errors.As(err, &streamErr) || streamErr.ErrorCode != h3.H3_ID_ERROR {
+		t.Fatalf("got %v, want a stop with H3_ID_ERROR", err)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2025 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Stream connection module of webtransport package.
+
+package webtransport
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StreamConn is a net.Conn over a bidirectional WebTransport stream, so that
+// protocols written for net.Conn, e.g. TLS, yamux or net/rpc, run over the
+// stream. Its addresses are the addresses of the QUIC connection of the
+// session.
+//
+// Close closes both directions of the stream, while CloseWrite and CloseRead
+// close one direction, as on a *net.TCPConn.
+type StreamConn struct {
+	str           Stream
+	writeDeadline deadline
+	closed        atomic.Bool
+}
+
+// NewStreamConn creates a new StreamConn over a stream returned by
+// Session.OpenStream or Session.AcceptStream.
+func NewStreamConn(str Stream) *StreamConn {
+	return &StreamConn{str: str}
+}
+
+// Stream returns the stream of the connection.
+func (c *StreamConn) Stream() Stream {
+	return c.str
+}
+
+// Read reads data from the stream.
+func (c *StreamConn) Read(p []byte) (int, error) {
+	if c.closed.Load() {
+		return 0, net.ErrClosed
+	}
+	return c.str.Read(p)
+}
+
+// Write writes data to the stream. Waiting for the send scheduler and the flow
+// control limit of the session is stopped by the write deadline, as the write
+// to the stream itself is.
+func (c *StreamConn) Write(p []byte) (int, error) {
+	if c.closed.Load() {
+		return 0, net.ErrClosed
+	}
+
+	// Stop waiting when the write deadline expires, even if it was changed
+	// while waiting
+	expired := c.writeDeadline.wait()
+	if isClosed(expired) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	ctx, cancel := context.WithCancel(c.str.Stream.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-expired:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	n, err := c.str.write(ctx, p)
+	if err != nil && isClosed(expired) {
+		err = os.ErrDeadlineExceeded
+	}
+	return n, err
+}
+
+// Close closes the stream: the send direction is closed after the written
+// data was sent, and the peer is asked to stop sending.
+func (c *StreamConn) Close() error {
+	if c.closed.Swap(true) {
+		return net.ErrClosed
+	}
+	c.str.CancelRead(0)
+	return c.str.Close()
+}
+
+// CloseWrite closes the send direction of the stream after the written data
+// was sent. The peer reads io.EOF.
+func (c *StreamConn) CloseWrite() error {
+	return c.str.Close()
+}
+
+// CloseRead stops reading from the stream, asking the peer to stop sending.
+func (c *StreamConn) CloseRead() error {
+	c.str.CancelRead(0)
+	return nil
+}
+
+// LocalAddr returns the local address of the QUIC connection.
+func (c *StreamConn) LocalAddr() net.Addr {
+	return c.str.session.Session.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the QUIC connection.
+func (c *StreamConn) RemoteAddr() net.Addr {
+	return c.str.session.Session.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines of the connection.
+func (c *StreamConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the connection.
+func (c *StreamConn) SetReadDeadline(t time.Time) error {
+	return c.str.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of the connection.
+func (c *StreamConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return c.str.SetWriteDeadline(t)
+}
+
+// deadline is a deadline which may be changed while it is waited for. The
+// wait channel is closed when the deadline expires.
+type deadline struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	expired chan struct{}
+}
+
+// set sets the deadline; a zero time clears it.
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		// The timer has fired and closes the channel
+		<-d.expired
+	}
+	d.timer = nil
+
+	// A new channel is used after the previous deadline expired
+	if d.expired == nil || isClosed(d.expired) {
+		d.expired = make(chan struct{})
+	}
+
+	if t.IsZero() {
+		return
+	}
+	dur := time.Until(t)
+	if dur <= 0 {
+		close(d.expired)
+		return
+	}
+	expired := d.expired
+	d.timer = time.AfterFunc(dur, func() { close(expired) })
+}
+
+// wait returns the channel which is closed when the deadline expires.
+func (d *deadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.expired == nil {
+		d.expired = make(chan struct{})
+	}
+	return d.expired
+}
+
+// isClosed reports whether the channel is closed.
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,144 @@
+package webtransport
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// streamConns returns a StreamConn on each side of a new stream of a session
+// whose server allows the client to send maxData bytes.
+func streamConns(t *testing.T, maxData uint64) (client, server *StreamConn) {
+	t.Helper()
+	url, sessions := startSessionServer(t, &Server{SessionMaxData: maxData})
+	clientSession, serverSession := dialSession(t, nil, url+"/wt", sessions)
+
+	str, err := clientSession.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The peer learns about the stream with its first data
+	if _, err := str.Write([]byte{0}); err != nil {
+		t.Fatal(err)
+	}
+	accepted, err := serverSession.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(accepted, make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	client, server = NewStreamConn(str), NewStreamConn(accepted)
+	t.Cleanup(func() { client.Close(); server.Close() })
+	return client, server
+}
+
+func TestStreamConn(t *testing.T) {
+	client, server := streamConns(t, 0)
+
+	if _, err := client.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "ping" {
+		t.Fatalf("got %q", data)
+	}
+
+	// The client may listen on the unspecified address
+	clientPort := client.LocalAddr().(*net.UDPAddr).Port
+	if port := server.RemoteAddr().(*net.UDPAddr).Port; port != clientPort {
+		t.Fatalf("client port %d, server sees port %d", clientPort, port)
+	}
+}
+
+func TestStreamConnClose(t *testing.T) {
+	client, _ := streamConns(t, 0)
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Read(make([]byte, 1)); err != net.ErrClosed {
+		t.Fatalf("read: got %v, want net.ErrClosed", err)
+	}
+	if _, err := client.Write([]byte{1}); err != net.ErrClosed {
+		t.Fatalf("write: got %v, want net.ErrClosed", err)
+	}
+	if err := client.Close(); err != net.ErrClosed {
+		t.Fatalf("second close: got %v, want net.ErrClosed", err)
+	}
+}
+
+func TestStreamConnReadDeadline(t *testing.T) {
+	_, server := streamConns(t, 0)
+	server.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err := server.Read(make([]byte, 1))
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+}
+
+func TestStreamConnWriteDeadline(t *testing.T) {
+	// The server reads nothing, so the write waits for the data limit of the
+	// session until the deadline expires
+	const maxData = 1000
+	client, server := streamConns(t, maxData)
+	client.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	n, err := client.Write(make([]byte, 5*maxData))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("got %v, want os.ErrDeadlineExceeded", err)
+	}
+	if n > maxData {
+		t.Fatalf("wrote %d bytes beyond the data limit", n)
+	}
+
+	// An expired deadline fails a write right away, a cleared one does not
+	if _, err := client.Write([]byte{1}); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("got %v, want os.ErrDeadlineExceeded", err)
+	}
+	client.SetWriteDeadline(time.Time{})
+	if _, err := io.ReadFull(server, make([]byte, n)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Write([]byte{1}); err != nil {
+		t.Fatalf("write without deadline: %v", err)
+	}
+}
+
+func TestStreamConnWriteDeadlineExtended(t *testing.T) {
+	const maxData = 1000
+	client, server := streamConns(t, maxData)
+	const initial = 50 * time.Millisecond
+	client.SetWriteDeadline(time.Now().Add(initial))
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := client.Write(make([]byte, 2*maxData))
+		written <- err
+	}()
+	session := client.Stream().Session()
+	waitFor(t, "the write to wait for the data limit", func() bool {
+		session.flowControl.mu.Lock()
+		defer session.flowControl.mu.Unlock()
+		return session.flowControl.sendData.available() == 0
+	})
+
+	// Extending the deadline while the write waits lets the write go on
+	// after the initial deadline, when the server reads
+	client.SetWriteDeadline(time.Now().Add(testTimeout))
+	time.Sleep(2 * initial)
+	if _, err := io.ReadFull(server, make([]byte, 2*maxData)); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+}
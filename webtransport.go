@@ -2,7 +2,7 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// Package webtransport provides a WebTransport-over-HTTP/3 server
+// Package webtransport provides a WebTransport-over-HTTP/3 server and client
 // implementation in Go.
 //
 // This package depend of the [quic-go](https://github.com/quic-go/quic-go)
@@ -14,22 +14,25 @@ package webtransport
 
 import (
 	"context"
-	"log"
+	"net"
 	"net/http"
 	"net/url"
-
 	"slices"
+	"sync"
+	"time"
 
 	"github.com/quic-go/qpack"
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
-	"github.com/quic-go/quic-go/quicvarint"
 	"github.com/teonet-go/webtransport-go/h3"
 )
 
 // A Server defines parameters for running a WebTransport server. Use
 // http.HandleFunc to register HTTP/3 endpoints for handling WebTransport
-// requests.
+// requests. Ordinary HTTP/3 requests, e.g. for the page and its assets, are
+// served by the same Handler on the same port; the Body of a WebTransport
+// request is a *Session, while the Body of an ordinary request reads the
+// request data.
 type Server struct {
 	http.Handler
 	// ListenAddr sets an address to bind server to, e.g. ":4433"
@@ -44,40 +47,221 @@ type Server struct {
 	AllowedOrigins []string
 	// Additional configuration parameters to pass onto QUIC listener
 	QuicConfig *QuicConfig
+	// MaxSessionsPerConnection sets the maximum number of concurrent
+	// WebTransport sessions on one QUIC connection. It is advertised to the
+	// client in the server SETTINGS. If zero, DefaultMaxSessionsPerConnection
+	// is used.
+	MaxSessionsPerConnection uint64
+
+	// MaxConnections limits the number of concurrent QUIC connections. The
+	// connections over the limit complete the handshake, every request on
+	// them, WebTransport session or not, is rejected with 503 Service
+	// Unavailable, and they are closed with the H3_EXCESSIVE_LOAD error code
+	// a second after the handshake. If zero, the number is not limited.
+	MaxConnections int
+	// MaxSessions limits the number of concurrent WebTransport sessions of
+	// the server. Sessions over the limit are rejected with 503 Service
+	// Unavailable. If zero, the number is not limited.
+	MaxSessions int
+	// MaxSessionsPerIP limits the number of concurrent WebTransport sessions
+	// from one client IP address. Sessions over the limit are rejected with
+	// 429 Too Many Requests. If zero, the number is not limited.
+	MaxSessionsPerIP int
+	// MaxSessionsPerPrefix limits the number of concurrent WebTransport
+	// sessions from one client network, whose size is set by IPv4PrefixLen
+	// and IPv6PrefixLen. Sessions over the limit are rejected with 429 Too
+	// Many Requests. If zero, the number is not limited.
+	MaxSessionsPerPrefix int
+	// IPv4PrefixLen and IPv6PrefixLen set the network prefix lengths used by
+	// MaxSessionsPerPrefix. If zero, DefaultIPv4PrefixLen and
+	// DefaultIPv6PrefixLen are used.
+	IPv4PrefixLen int
+	IPv6PrefixLen int
+	// MaxPendingStreams sets the maximum number of incoming bidirectional and
+	// unidirectional streams each waiting in the accept queue of a
+	// WebTransport session until the handler accepts them. Streams over the
+	// limit are reset with the WEBTRANSPORT_BUFFERED_STREAM_REJECTED error
+	// code. If zero, DefaultMaxPendingStreams is used; if negative, the queues
+	// are not limited.
+	MaxPendingStreams int
+	// SessionIdleTimeout closes WebTransport sessions without stream or
+	// datagram activity for this duration (see Session.SetIdleTimeout). If
+	// zero, sessions are not closed when idle.
+	SessionIdleTimeout time.Duration
+	// SessionKeepAlivePeriod sets the keepalive period of WebTransport
+	// sessions (see Session.SetKeepAlivePeriod). If zero, no keepalives are
+	// sent.
+	SessionKeepAlivePeriod time.Duration
+	// SessionMaxData is the number of bytes the client may send on the
+	// streams of one WebTransport session before the handler read them; the
+	// limit is raised as the handler reads. SessionMaxStreamsBidi and
+	// SessionMaxStreamsUni limit the number of concurrent bidirectional and
+	// unidirectional streams the client may open in one session. The limits
+	// are advertised in the server SETTINGS and apply to Draft09 sessions. A
+	// client sending more data or opening more streams gets the
+	// WT_FLOW_CONTROL_ERROR error. The received data is counted as it
+	// arrives, so the data of a session with a data limit is buffered until
+	// the handler reads it. If zero, the value is not limited.
+	SessionMaxData        uint64
+	SessionMaxStreamsBidi uint64
+	SessionMaxStreamsUni  uint64
+	// RetryAfter is the delay suggested to clients in the Retry-After header
+	// of a session rejected by an admission limit. If zero, DefaultRetryAfter
+	// is used.
+	RetryAfter time.Duration
+
+	// ConnContext optionally specifies a function that modifies the context
+	// used for a new connection. The WebTransport sessions and requests of the
+	// connection use contexts derived from the returned context, e.g. to
+	// attach per-connection data such as a geo lookup or a tenant ID. The
+	// provided ctx has the http3.ServerContextKey and
+	// http.LocalAddrContextKey values set.
+	ConnContext func(ctx context.Context, c quic.Connection) context.Context
+	// OnConnection optionally specifies a function that is called for each
+	// new connection before the HTTP/3 handshake. If it returns an error, the
+	// connection is closed with the H3_REQUEST_REJECTED error code and the
+	// error text.
+	OnConnection func(ctx context.Context, c quic.Connection) error
+	// OnSessionStart optionally specifies a function that is called when a
+	// WebTransport session is established, before the handler is called.
+	OnSessionStart func(s *Session)
+	// OnSessionEnd optionally specifies a function that is called when a
+	// WebTransport session ends, with the *SessionError describing why it
+	// ended (see Session.Err). It is called after OnSessionStart returned,
+	// even if the session ended while OnSessionStart was running.
+	OnSessionEnd func(s *Session, err error)
+
+	mu             sync.Mutex
+	listeners      map[*serverListener]struct{}
+	conns          map[*conn]struct{}
+	activeHandlers int
+	inShutdown     bool
+	admission      admission
+	registry       registry
 }
 
+// DefaultMaxSessionsPerConnection is the default maximum number of concurrent
+// WebTransport sessions on one QUIC connection.
+const DefaultMaxSessionsPerConnection = 16
+
+// DefaultMaxPendingStreams is the default maximum number of incoming streams
+// of each direction waiting in the accept queue of a WebTransport session.
+const DefaultMaxPendingStreams = 64
+
 // QuicConfig is a wrapper for quic.Config.
 type QuicConfig quic.Config
 
 // Starts a WebTransport server and blocks while it's running. Cancel the
-// supplied Context to stop the server.
+// supplied Context to stop the server immediately, after which Run returns the
+// context's error, or call Shutdown to stop it gracefully, after which Run
+// returns ErrServerClosed.
 func (s *Server) Run(ctx context.Context) error {
-	if s.Handler == nil {
-		s.Handler = http.DefaultServeMux
+	udpAddr, err := net.ResolveUDPAddr("udp", s.ListenAddr)
+	if err != nil {
+		return err
 	}
-	if s.QuicConfig == nil {
-		s.QuicConfig = &QuicConfig{}
+	udpConn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return err
 	}
-	s.QuicConfig.EnableDatagrams = true
 
-	tlsConfig, err := s.makeTLSConfig()
+	// Listen on a quic.Transport, so that closing the listener on Shutdown
+	// keeps the established connections open while their sessions drain
+	transport := &quic.Transport{Conn: udpConn}
+	listener, err := s.listen(transport)
 	if err != nil {
+		udpConn.Close()
 		return err
 	}
 
-	listener, err := quic.ListenAddr(s.ListenAddr, tlsConfig, (*quic.Config)(s.QuicConfig))
+	err = s.serve(ctx, &serverListener{
+		Listener:   listener,
+		transport:  transport,
+		packetConn: udpConn,
+	})
+
+	// Canceling the context stops the server immediately. Run returns the
+	// context's error, unless Shutdown stopped the server first.
+	if ctx.Err() != nil {
+		s.close()
+		if err != ErrServerClosed {
+			err = ctx.Err()
+		}
+	}
+	return err
+}
+
+// Serve starts a WebTransport server on the supplied net.PacketConn and blocks
+// while it's running. Call Shutdown to stop the server, after which Serve
+// returns ErrServerClosed. The packet connection is not closed by the server.
+func (s *Server) Serve(conn net.PacketConn) error {
+	transport := &quic.Transport{Conn: conn}
+	listener, err := s.listen(transport)
+	if err != nil {
+		return err
+	}
+	return s.serve(context.Background(), &serverListener{
+		Listener:  listener,
+		transport: transport,
+	})
+}
+
+// ServeTransport starts a WebTransport server on the supplied quic.Transport
+// and blocks while it's running, so that the UDP socket of the transport may
+// be shared with other QUIC services. Call Shutdown to stop the server, after
+// which ServeTransport returns ErrServerClosed. The transport is not closed by
+// the server.
+func (s *Server) ServeTransport(tr *quic.Transport) error {
+	listener, err := s.listen(tr)
 	if err != nil {
 		return err
 	}
+	return s.serve(context.Background(), &serverListener{Listener: listener})
+}
+
+// ServeListener starts a WebTransport server on the supplied quic.Listener and
+// blocks while it's running. Call Shutdown to stop the server, after which
+// ServeListener returns ErrServerClosed.
+//
+// The listener is used as is: the TLSCert, TLSKey and QuicConfig fields of the
+// Server are ignored. Its tls.Config must offer the "h3" ALPN protocol and its
+// quic.Config must enable datagrams.
+func (s *Server) ServeListener(ln *quic.Listener) error {
+	return s.serve(context.Background(), &serverListener{Listener: ln})
+}
+
+// listen starts listening for QUIC connections on the transport with the
+// Server's TLS and QUIC configuration.
+func (s *Server) listen(tr *quic.Transport) (*quic.Listener, error) {
+	if s.QuicConfig == nil {
+		s.QuicConfig = &QuicConfig{}
+	}
+	s.QuicConfig.EnableDatagrams = true
+
+	tlsConfig, err := s.makeTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return tr.Listen(tlsConfig, (*quic.Config)(s.QuicConfig))
+}
 
-	go func() {
-		<-ctx.Done()
-		listener.Close()
-	}()
+// serve accepts connections from the listener and handles each of them in a
+// new goroutine until the listener is closed.
+func (s *Server) serve(ctx context.Context, l *serverListener) error {
+	if s.Handler == nil {
+		s.Handler = http.DefaultServeMux
+	}
+	if !s.trackListener(l) {
+		l.close()
+		return ErrServerClosed
+	}
 
 	for {
-		sess, err := listener.Accept(ctx)
+		sess, err := l.Accept(ctx)
 		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
 			return err
 		}
 		go s.handleSession(ctx, sess)
@@ -85,121 +269,213 @@ func (s *Server) Run(ctx context.Context) error {
 }
 
 // handleSession is called for each new quic.Connection and handles the
-// initial messages exchanged on the control streams.
+// initial messages exchanged on the control streams. It then accepts every
+// bidirectional stream opened by the client until the connection is closed,
+// so that any number of WebTransport sessions may share the connection.
 func (s *Server) handleSession(ctx context.Context, sess quic.Connection) {
-	// Open a unidirectional stream for the server control stream
-	serverControlStream, err := sess.OpenUniStream()
-	if err != nil {
-		return
+	// Create connection context, which is canceled when the connection is
+	// closed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx = context.WithValue(ctx, http3.ServerContextKey, s)
+	ctx = context.WithValue(ctx, http.LocalAddrContextKey, sess.LocalAddr())
+	if s.ConnContext != nil {
+		ctx = s.ConnContext(ctx, sess)
+		if ctx == nil {
+			panic("ConnContext returned nil")
+		}
+	}
+	if s.OnConnection != nil {
+		if err := s.OnConnection(ctx, sess); err != nil {
+			sess.CloseWithError(h3.H3_REQUEST_REJECTED, err.Error())
+			return
+		}
 	}
 
-	// Write server settings header
-	streamHeader := h3.StreamHeader{Type: h3.STREAM_CONTROL}
-	streamHeader.Write(serverControlStream)
-
-	// Write server settings
-	settingsFrame := (h3.SettingsMap{
-		h3.H3_DATAGRAM_05:      1,
-		h3.ENABLE_WEBTRANSPORT: 1,
-	}).ToFrame()
-	settingsFrame.Write(serverControlStream)
+	c := newConn(s, sess)
 
-	// Accept control stream - client settings will appear here
-	clientControlStream, err := sess.AcceptUniStream(context.Background())
+	// Open the server control stream and write the server settings,
+	// advertising every supported draft. The draft of each session is then
+	// picked from the client settings.
+	settings := h3.SettingsMap{
+		h3.SETTINGS_ENABLE_CONNECT_PROTOCOL: 1,
+		h3.SETTINGS_H3_DATAGRAM:             1,
+		h3.H3_DATAGRAM_05:                   1,
+		h3.ENABLE_WEBTRANSPORT:              1,
+		h3.WEBTRANSPORT_MAX_SESSIONS:        s.maxSessionsPerConnection(),
+	}
+	c.limits = flowLimits{
+		maxData:        s.SessionMaxData,
+		maxStreamsBidi: s.SessionMaxStreamsBidi,
+		maxStreamsUni:  s.SessionMaxStreamsUni,
+	}
+	c.limits.addSettings(settings)
+	if s.MaxPendingStreams != 0 {
+		c.maxPendingStreams = s.MaxPendingStreams
+	}
+	err := c.openControlStream(settings)
 	if err != nil {
-		log.Println(err)
 		return
 	}
 
-	// Read client settings
-	clientSettingsReader := quicvarint.NewReader(clientControlStream)
-	quicvarint.Read(clientSettingsReader)
-
-	// Read client settings
-	clientSettingsFrame := h3.Frame{}
-	if err = clientSettingsFrame.Read(clientControlStream); err != nil ||
-		clientSettingsFrame.Type != h3.FRAME_SETTINGS {
+	// Register the connection, so that Shutdown can send GOAWAY on it
+	if !s.trackConn(c) {
+		sess.CloseWithError(h3.H3_NO_ERROR, "server is shutting down")
 		return
 	}
+	defer s.untrackConn(c)
 
-	// Accept request stream
-	requestStream, err := sess.AcceptStream(ctx)
-	if err != nil {
-		return
+	// Count the connection; requests on a connection over the limit are
+	// rejected, and the connection is closed shortly after
+	if c.overLimit = !s.admitConn(); c.overLimit {
+		defer s.closeOverLimit(c)()
+	} else {
+		defer s.releaseConn()
 	}
 
-	// Create context
-	ctx, cancelFunction := context.WithCancel(requestStream.Context())
-	ctx = context.WithValue(ctx, http3.ServerContextKey, s)
-	ctx = context.WithValue(ctx, http.LocalAddrContextKey, sess.LocalAddr())
+	// Accept client control stream and WebTransport unidirectional streams,
+	// and receive datagrams
+	go c.acceptUniStreams()
+	go c.receiveDatagrams()
 
-	// Read headers
-	headersFrame := h3.Frame{}
-	err = headersFrame.Read(requestStream)
-	if err != nil {
-		cancelFunction()
-		requestStream.Close()
-		return
-	}
-	if headersFrame.Type != h3.FRAME_HEADERS {
-		cancelFunction()
-		requestStream.Close()
-		return
-	}
+	// Accept request streams and WebTransport bidirectional streams
+	c.acceptStreams(ctx)
+}
+
+// handleRequest handles a request stream opened by the client on the
+// connection c. The HEADERS frame of the request has already been read.
+func (s *Server) handleRequest(ctx context.Context, c *conn,
+	requestStream quic.Stream, headersFrame h3.Frame) {
 
 	// Decode headers
 	decoder := qpack.NewDecoder(nil)
 	hfs, err := decoder.DecodeFull(headersFrame.Data)
 	if err != nil {
-		cancelFunction()
 		requestStream.Close()
 		return
 	}
 	req, protocol, err := h3.RequestFromHeaders(hfs)
 	if err != nil {
-		cancelFunction()
 		requestStream.Close()
 		return
 	}
-	req.RemoteAddr = sess.RemoteAddr().String()
+	req.RemoteAddr = c.RemoteAddr().String()
+	connectionState := c.ConnectionState()
+	req.TLS = &connectionState.TLS
 
-	// Create request
-	req = req.WithContext(ctx)
+	// Any request other than a WebTransport extended CONNECT is an ordinary
+	// HTTP/3 request
+	if req.Method != http.MethodConnect || protocol != "webtransport" {
+		c.requestDone(requestStream.StreamID())
+		if c.overLimit {
+			s.rejectOverLimit(requestStream)
+			return
+		}
+
+		// Create context, which is derived from the connection context and
+		// canceled when the request stream is closed
+		ctx, cancelFunction := context.WithCancel(ctx)
+		context.AfterFunc(requestStream.Context(), cancelFunction)
+		s.serveHTTP(ctx, cancelFunction, requestStream, req)
+		return
+	}
+
+	// Wait for client settings
+	if !c.waitSettings(ctx) {
+		return
+	}
+
+	// Pick the newest draft supported by both sides. A client which sends a
+	// WebTransport request without advertising WebTransport and datagram
+	// support in its settings is in error.
+	draft, ok := negotiateDraft(c.peerSettings)
+	if !ok {
+		c.CloseWithError(h3.H3_SETTINGS_ERROR,
+			"webtransport request without webtransport settings")
+		return
+	}
+
+	// Create the session and the request, whose context is the session
+	// context
 	rw := h3.NewResponseWriter(requestStream)
-	rw.Header().Add("sec-webtransport-http3-draft", "draft02")
-	req.Body = &Session{
-		Stream:              requestStream,
-		Session:             sess,
-		ClientControlStream: clientControlStream,
-		ServerControlStream: serverControlStream,
-		responseWriter:      rw,
-		context:             ctx,
-		cancel:              cancelFunction,
+	if draft == Draft02 {
+		rw.Header().Add("sec-webtransport-http3-draft", "draft02")
 	}
+	session := newSession(c, requestStream, draft, ctx)
+	session.responseWriter = rw
+	req = req.WithContext(session.Context())
+	req.Body = session
 
 	// Validate origin
-	if protocol != "webtransport" || !s.validateOrigin(req.Header.Get("origin")) {
-		req.Body.(*Session).RejectSession(http.StatusBadRequest)
+	if !s.validateOrigin(req.Header.Get("origin")) {
+		session.RejectSession(http.StatusBadRequest)
 		return
 	}
 
-	// Close the request stream when the response is sent
-	go func() {
-		for {
-			buf := make([]byte, 1024)
-			_, err := requestStream.Read(buf)
-			if err != nil {
-				cancelFunction()
-				requestStream.Close()
-				break
-			}
-		}
-	}()
+	// Apply the admission limits
+	release, status := s.admitSession(c)
+	if release == nil {
+		rw.Header().Set("Retry-After", s.retryAfter())
+		session.RejectSession(status)
+		return
+	}
+	session.release = release
+
+	// Register the session on the connection
+	if !c.addSession(session, s.maxSessionsPerConnection()) {
+		release()
+		session.RejectSession(http.StatusTooManyRequests)
+		return
+	}
+	s.registerSession(session, req)
+
+	// OnSessionStart returns before the request stream watcher starts, as the
+	// watcher calls OnSessionEnd when the session ends
+	if s.OnSessionStart != nil {
+		s.OnSessionStart(session)
+	}
+	go session.watchRequestStream()
+	session.SetIdleTimeout(s.SessionIdleTimeout)
+	session.SetKeepAlivePeriod(s.SessionKeepAlivePeriod)
 
 	// Serve the request
+	s.handlerStarted()
+	defer s.handlerDone()
 	s.ServeHTTP(rw, req)
 }
 
+// serveHTTP serves an ordinary HTTP/3 request on the request stream. The
+// request body is read from the DATA frames of the stream and the response is
+// finished when the handler returns.
+func (s *Server) serveHTTP(ctx context.Context, cancel context.CancelFunc,
+	requestStream quic.Stream, req *http.Request) {
+
+	defer cancel()
+
+	body := h3.NewBody(requestStream)
+	req = req.WithContext(ctx)
+	req.Body = body
+	rw := h3.NewResponseWriter(requestStream)
+
+	// Serve the request
+	s.handlerStarted()
+	defer s.handlerDone()
+	s.ServeHTTP(rw, req)
+
+	// Finish the response and stop reading the rest of the request body
+	rw.Close()
+	body.Close()
+}
+
+// maxSessionsPerConnection returns the maximum number of concurrent
+// WebTransport sessions on one connection.
+func (s *Server) maxSessionsPerConnection() uint64 {
+	if s.MaxSessionsPerConnection == 0 {
+		return DefaultMaxSessionsPerConnection
+	}
+	return s.MaxSessionsPerConnection
+}
+
 // validateOrigin checks if the given origin is allowed to access the
 // WebTransport server. An empty AllowedOrigins slice allows all origins.
 func (s *Server) validateOrigin(origin string) bool {
@@ -0,0 +1,354 @@
+package webtransport
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/teonet-go/webtransport-go/h3"
+)
+
+// testTimeout bounds every wait of the tests.
+const testTimeout = 5 * time.Second
+
+// testCert returns a self-signed certificate and key for the loopback
+// address.
+func testCert(t testing.TB) (cert, key CertFile) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert.Data = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	key.Data = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return
+}
+
+// startServer serves the server on a UDP socket of the loopback interface
+// until the test ends and returns the base URL of the server. The TLS
+// certificate is set if the server has none.
+func startServer(t testing.TB, s *Server) string {
+	t.Helper()
+	if s.TLSCert.Data == nil && s.TLSCert.Path == "" {
+		s.TLSCert, s.TLSKey = testCert(t)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(conn) }()
+	t.Cleanup(func() {
+		s.close()
+		conn.Close()
+		if err := <-served; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Serve returned %v", err)
+		}
+	})
+	return "https://" + conn.LocalAddr().String()
+}
+
+// startSessionServer serves a server whose handler accepts every WebTransport
+// session and passes it to the returned channel. The handler returns when the
+// session ends.
+func startSessionServer(t testing.TB, s *Server) (string, <-chan *Session) {
+	t.Helper()
+	sessions := acceptSessions(s)
+	return startServer(t, s), sessions
+}
+
+// acceptSessions sets the handler of the server to accept every WebTransport
+// session and pass it to the returned channel. The handler returns when the
+// session ends.
+func acceptSessions(s *Server) <-chan *Session {
+	sessions := make(chan *Session, 16)
+	s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := r.Body.(*Session)
+		session.AcceptSession()
+		sessions <- session
+		<-session.Context().Done()
+	})
+	return sessions
+}
+
+// testDialer returns a Dialer which trusts any server certificate.
+func testDialer() *Dialer {
+	return &Dialer{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+}
+
+// dialSession dials a session with the dialer, or with testDialer if it is
+// nil, and returns the client and the server side of the session. The client
+// side is closed when the test ends.
+func dialSession(t testing.TB, d *Dialer, url string,
+	sessions <-chan *Session) (client, server *Session) {
+
+	t.Helper()
+	if d == nil {
+		d = testDialer()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	_, client, err := d.Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.CloseConnection(0, "") })
+	select {
+	case server = <-sessions:
+	case <-ctx.Done():
+		t.Fatal("the server did not accept the session")
+	}
+	return client, server
+}
+
+// testContext returns a context which is canceled after testTimeout or when
+// the test ends.
+func testContext(t testing.TB) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestRunContextCanceled(t *testing.T) {
+	cert, key := testCert(t)
+	for range 20 {
+		s := &Server{ListenAddr: "127.0.0.1:0", TLSCert: cert, TLSKey: key}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- s.Run(ctx) }()
+		cancel()
+
+		select {
+		case err := <-done:
+			if err != context.Canceled {
+				t.Fatalf("Run returned %v, want context.Canceled", err)
+			}
+		case <-time.After(testTimeout):
+			t.Fatal("Run did not return")
+		}
+	}
+}
+
+func TestRunShutdown(t *testing.T) {
+	cert, key := testCert(t)
+	s := &Server{ListenAddr: "127.0.0.1:0", TLSCert: cert, TLSKey: key}
+	done := make(chan error, 1)
+	go func() { done <- s.Run(context.Background()) }()
+	if err := s.Shutdown(testContext(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if err != ErrServerClosed {
+			t.Fatalf("Run returned %v, want ErrServerClosed", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Run did not return")
+	}
+}
+
+// serveUntilClosed runs serve and checks that it returns ErrServerClosed
+// after the server is shut down, with the session of the client closed
+// first so that Shutdown does not wait for its handler.
+func serveUntilClosed(t *testing.T, s *Server, url string,
+	sessions <-chan *Session, serve func() error) {
+
+	t.Helper()
+	served := make(chan error, 1)
+	go func() { served <- serve() }()
+	client, _ := dialSession(t, nil, url+"/wt", sessions)
+	client.CloseSession()
+	if err := s.Shutdown(testContext(t)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-served:
+		if err != ErrServerClosed {
+			t.Fatalf("got %v, want ErrServerClosed", err)
+		}
+	case <-testContext(t).Done():
+		t.Fatal("the server did not stop")
+	}
+}
+
+func TestServeTransport(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &quic.Transport{Conn: conn}
+	defer tr.Close()
+
+	s := &Server{}
+	s.TLSCert, s.TLSKey = testCert(t)
+	sessions := acceptSessions(s)
+	serveUntilClosed(t, s, "https://"+conn.LocalAddr().String(), sessions,
+		func() error { return s.ServeTransport(tr) })
+
+	// The transport of the caller is still open
+	tlsConfig, err := s.makeTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tr.Listen(tlsConfig, nil)
+	if err != nil {
+		t.Fatalf("the transport was closed: %v", err)
+	}
+	ln.Close()
+}
+
+func TestServeListener(t *testing.T) {
+	s := &Server{}
+	s.TLSCert, s.TLSKey = testCert(t)
+	tlsConfig, err := s.makeTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := quic.ListenAddr("127.0.0.1:0", tlsConfig,
+		&quic.Config{EnableDatagrams: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	sessions := acceptSessions(s)
+	serveUntilClosed(t, s, "https://"+ln.Addr().String(), sessions,
+		func() error { return s.ServeListener(ln) })
+}
+
+func TestServeAfterShutdown(t *testing.T) {
+	s := &Server{}
+	s.TLSCert, s.TLSKey = testCert(t)
+	if err := s.Shutdown(testContext(t)); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := s.Serve(conn); err != ErrServerClosed {
+		t.Fatalf("got %v, want ErrServerClosed", err)
+	}
+}
+
+type testContextKey struct{}
+
+func TestConnContext(t *testing.T) {
+	s := &Server{
+		ConnContext: func(ctx context.Context, c quic.Connection) context.Context {
+			return context.WithValue(ctx, testContextKey{}, "tenant")
+		},
+	}
+	url, sessions := startSessionServer(t, s)
+	_, server := dialSession(t, nil, url+"/wt", sessions)
+
+	ctx := server.Context()
+	if v := ctx.Value(testContextKey{}); v != "tenant" {
+		t.Fatalf("got value %v, want tenant", v)
+	}
+	if v := ctx.Value(http3.ServerContextKey); v != s {
+		t.Fatalf("got server %v", v)
+	}
+}
+
+func TestOnConnectionRejects(t *testing.T) {
+	s := &Server{
+		OnConnection: func(ctx context.Context, c quic.Connection) error {
+			return errors.New("banned")
+		},
+	}
+	url := startServer(t, s)
+	qconn := dialQUIC(t, url)
+	if code := connectionError(t, qconn); code != h3.H3_REQUEST_REJECTED {
+		t.Fatalf("got error code %#x, want H3_REQUEST_REJECTED", code)
+	}
+}
+
+func TestSessionHooks(t *testing.T) {
+	started := make(chan *Session, 1)
+	ended := make(chan error, 1)
+	s := &Server{
+		OnSessionStart: func(s *Session) { started <- s },
+		OnSessionEnd:   func(s *Session, err error) { ended <- err },
+	}
+	url, sessions := startSessionServer(t, s)
+	client, server := dialSession(t, nil, url+"/wt", sessions)
+
+	select {
+	case s := <-started:
+		if s != server {
+			t.Fatal("OnSessionStart called with another session")
+		}
+	default:
+		t.Fatal("OnSessionStart not called before the handler")
+	}
+
+	client.CloseWithError(3, "done")
+	select {
+	case err := <-ended:
+		var sessionErr *SessionError
+		if !errors.As(err, &sessionErr) || sessionErr.ErrorCode != 3 {
+			t.Fatalf("OnSessionEnd called with %v", err)
+		}
+	case <-testContext(t).Done():
+		t.Fatal("OnSessionEnd not called")
+	}
+}
+
+func TestSessionEndAfterStart(t *testing.T) {
+	var startReturned atomic.Bool
+	ended := make(chan bool, 1)
+	s := &Server{
+		// The session ends while OnSessionStart is running
+		OnSessionStart: func(s *Session) {
+			s.CloseConnection(0, "")
+			<-s.Context().Done()
+			time.Sleep(20 * time.Millisecond)
+			startReturned.Store(true)
+		},
+		OnSessionEnd: func(s *Session, err error) { ended <- startReturned.Load() },
+	}
+	url, _ := startSessionServer(t, s)
+	testDialer().Dial(testContext(t), url+"/wt", nil)
+
+	select {
+	case returned := <-ended:
+		if !returned {
+			t.Fatal("OnSessionEnd called before OnSessionStart returned")
+		}
+	case <-testContext(t).Done():
+		t.Fatal("OnSessionEnd not called")
+	}
+}